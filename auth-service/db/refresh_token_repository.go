@@ -0,0 +1,98 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/chepyr/go-task-tracker/shared/models"
+	"github.com/google/uuid"
+)
+
+// ErrInvalidRefreshToken is returned for unknown, expired or already rotated refresh tokens
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+type RefreshTokenRepository struct {
+	db *sql.DB
+}
+
+func NewRefreshTokenRepository(db *sql.DB) *RefreshTokenRepository {
+	return &RefreshTokenRepository{db: db}
+}
+
+func (r *RefreshTokenRepository) Create(ctx context.Context, token *models.RefreshToken) error {
+	query := `INSERT INTO refresh_tokens (token_hash, user_id, expires_at, created_at)
+	 VALUES ($1, $2, $3, $4)`
+	_, err := r.db.ExecContext(ctx, query, token.TokenHash, token.UserID, token.ExpiresAt, token.CreatedAt)
+	return err
+}
+
+/*
+Rotate marks the token oldHash as exchanged for next and stores next, in one transaction.
+next.CreatedAt is the time of the rotation, next.UserID is set from the old token.
+
+A rotated token is rejected, except once within grace after its rotation,
+and only while its successor is still current: once the successor has been
+rotated too, the old token is no longer the immediately previous one.
+Each statement checks and updates the row at once, so concurrent rotations
+of the same token, also from other replicas, can't both take the normal path.
+*/
+func (r *RefreshTokenRepository) Rotate(
+	ctx context.Context, oldHash string, next *models.RefreshToken, grace time.Duration,
+) (uuid.UUID, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer tx.Rollback()
+
+	now := next.CreatedAt
+	query := `UPDATE refresh_tokens SET rotated_at = $1, successor_hash = $2
+	 WHERE token_hash = $3 AND rotated_at IS NULL AND expires_at > $1`
+	res, err := tx.ExecContext(ctx, query, now, next.TokenHash, oldHash)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	if n == 0 && grace > 0 {
+		query = `UPDATE refresh_tokens SET grace_used = TRUE
+		 WHERE token_hash = $1 AND NOT grace_used AND rotated_at > $2 AND expires_at > $3
+		 AND successor_hash IN (SELECT token_hash FROM refresh_tokens WHERE rotated_at IS NULL)`
+		res, err = tx.ExecContext(ctx, query, oldHash, now.Add(-grace), now)
+		if err != nil {
+			return uuid.Nil, err
+		}
+		if n, err = res.RowsAffected(); err != nil {
+			return uuid.Nil, err
+		}
+	}
+	if n == 0 {
+		return uuid.Nil, ErrInvalidRefreshToken
+	}
+
+	query = `SELECT user_id FROM refresh_tokens WHERE token_hash = $1`
+	if err := tx.QueryRowContext(ctx, query, oldHash).Scan(&next.UserID); err != nil {
+		return uuid.Nil, err
+	}
+	query = `INSERT INTO refresh_tokens (token_hash, user_id, expires_at, created_at)
+	 VALUES ($1, $2, $3, $4)`
+	if _, err := tx.ExecContext(ctx, query, next.TokenHash, next.UserID, next.ExpiresAt, next.CreatedAt); err != nil {
+		return uuid.Nil, err
+	}
+	return next.UserID, tx.Commit()
+}
+
+// DeleteExpired drops expired tokens and rotated tokens past their grace window
+func (r *RefreshTokenRepository) DeleteExpired(ctx context.Context, now time.Time, grace time.Duration) (int64, error) {
+	query := `DELETE FROM refresh_tokens WHERE expires_at <= $1 OR rotated_at <= $2`
+	res, err := r.db.ExecContext(ctx, query, now, now.Add(-grace))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,100 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/chepyr/go-task-tracker/shared/models"
+	"github.com/google/uuid"
+)
+
+func newRefreshToken(hash string, at time.Time) *models.RefreshToken {
+	return &models.RefreshToken{TokenHash: hash, ExpiresAt: at.Add(time.Hour), CreatedAt: at}
+}
+
+func TestRefreshTokenRepository_Rotate(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	repo := NewRefreshTokenRepository(db)
+	ctx := context.Background()
+
+	userID := uuid.New()
+	now := time.Now().UTC()
+	first := newRefreshToken("t0", now)
+	first.UserID = userID
+	if err := repo.Create(ctx, first); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	got, err := repo.Rotate(ctx, "t0", newRefreshToken("t1", now), 0)
+	if err != nil || got != userID {
+		t.Fatalf("Rotate: user=%s err=%v, want %s", got, err, userID)
+	}
+	// without a grace window the rotated token is rejected
+	if _, err := repo.Rotate(ctx, "t0", newRefreshToken("t1b", now), 0); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("Expected ErrInvalidRefreshToken for reuse, got %v", err)
+	}
+	if _, err := repo.Rotate(ctx, "unknown", newRefreshToken("x", now), time.Minute); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("Expected ErrInvalidRefreshToken for unknown token, got %v", err)
+	}
+}
+
+// grace only applies while the successor is still the current token
+func TestRefreshTokenRepository_GraceRequiresCurrentSuccessor(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	repo := NewRefreshTokenRepository(db)
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	first := newRefreshToken("t0", now)
+	first.UserID = uuid.New()
+	if err := repo.Create(ctx, first); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := repo.Rotate(ctx, "t0", newRefreshToken("t1", now), time.Minute); err != nil {
+		t.Fatalf("Rotate t0: %v", err)
+	}
+	if _, err := repo.Rotate(ctx, "t1", newRefreshToken("t2", now), time.Minute); err != nil {
+		t.Fatalf("Rotate t1: %v", err)
+	}
+
+	// t0 is two rotations back, its successor t1 is no longer current
+	if _, err := repo.Rotate(ctx, "t0", newRefreshToken("t0-grace", now), time.Minute); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("Expected t0 to be rejected, got %v", err)
+	}
+	// t1 is the immediately previous token and gets its grace, once
+	if _, err := repo.Rotate(ctx, "t1", newRefreshToken("t1-grace", now), time.Minute); err != nil {
+		t.Fatalf("Expected grace for t1, got %v", err)
+	}
+	if _, err := repo.Rotate(ctx, "t1", newRefreshToken("t1-again", now), time.Minute); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("Expected the grace of t1 to be used up, got %v", err)
+	}
+}
+
+func TestRefreshTokenRepository_DeleteExpired(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	repo := NewRefreshTokenRepository(db)
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	expired := newRefreshToken("expired", now.Add(-2*time.Hour))
+	current := newRefreshToken("current", now)
+	for _, token := range []*models.RefreshToken{expired, current} {
+		token.UserID = uuid.New()
+		if err := repo.Create(ctx, token); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	n, err := repo.DeleteExpired(ctx, now, time.Minute)
+	if err != nil || n != 1 {
+		t.Fatalf("DeleteExpired: n=%d err=%v, want 1", n, err)
+	}
+	if _, err := repo.Rotate(ctx, "current", newRefreshToken("next", now), 0); err != nil {
+		t.Fatalf("Expected the current token to survive cleanup, got %v", err)
+	}
+}
@@ -11,6 +11,7 @@ import (
 type UserRepositoryInterface interface {
 	Create(ctx context.Context, user *models.User) error
 	GetByEmail(ctx context.Context, email string) (*models.User, error)
+	GetByID(ctx context.Context, id string) (*models.User, error)
 }
 
 type UserRepository struct {
@@ -38,3 +39,12 @@ func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*models.
 	)
 	return user, err
 }
+
+func (r *UserRepository) GetByID(ctx context.Context, id string) (*models.User, error) {
+	query := `SELECT id, email, password_hash, created_at, updated_at FROM users WHERE id = $1`
+	user := &models.User{}
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
+		&user.ID, &user.Email, &user.PasswordHash, &user.CreatedAt, &user.UpdatedAt,
+	)
+	return user, err
+}
@@ -29,6 +29,19 @@ func setupTestDB(t *testing.T) *sql.DB {
 		t.Fatalf("Failed to create users table: %v", err)
 	}
 
+	_, err = db.Exec(`CREATE TABLE refresh_tokens (
+		token_hash VARCHAR(64) PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		expires_at TIMESTAMP NOT NULL,
+		rotated_at TIMESTAMP,
+		successor_hash VARCHAR(64),
+		grace_used BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		t.Fatalf("Failed to create refresh_tokens table: %v", err)
+	}
+
 	return db
 }
 
@@ -1,15 +1,43 @@
 package handlers
 
 import (
+	"net"
+	"net/http"
 	"sync"
 	"time"
 
 	"github.com/chepyr/go-task-tracker/auth-service/db"
+	"github.com/chepyr/go-task-tracker/shared"
 )
 
 type Handler struct {
 	UserRepo    db.UserRepositoryInterface
 	RateLimiter *RateLimiter
+	// requests bearing this key in shared.InternalAPIKeyHeader bypass the rate limiter
+	InternalAPIKey string
+	// issues refresh tokens on login, nil disables them
+	RefreshTokens *RefreshTokenStore
+	// signs and validates access tokens, loaded once at startup
+	JWTSecret string
+	// accept register/login bodies with data after the JSON value, for legacy clients
+	AllowTrailingJSON bool
+}
+
+// internal callers are never rate limited
+func (handler *Handler) allowRequest(request *http.Request) bool {
+	if handler.RateLimiter == nil || shared.IsInternalCaller(request, handler.InternalAPIKey) {
+		return true
+	}
+	return handler.RateLimiter.Allow(clientIP(request))
+}
+
+// rate limit key of the request: the remote host without the port, which changes per connection
+func clientIP(request *http.Request) string {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return request.RemoteAddr
+	}
+	return host
 }
 
 type RateLimiter struct {
@@ -17,6 +45,8 @@ type RateLimiter struct {
 	limit    int
 	mutex    sync.Mutex
 	window   time.Duration
+	// when the attempts are cleared next
+	resetAt time.Time
 }
 
 // reset the attempts map every window duration
@@ -24,6 +54,7 @@ func (rateLimiter *RateLimiter) cleanup() {
 	for range time.Tick(rateLimiter.window) {
 		rateLimiter.mutex.Lock()
 		rateLimiter.attempts = make(map[string]int)
+		rateLimiter.resetAt = time.Now().Add(rateLimiter.window)
 		rateLimiter.mutex.Unlock()
 	}
 }
@@ -33,6 +64,7 @@ func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
 		attempts: make(map[string]int),
 		limit:    limit,
 		window:   window,
+		resetAt:  time.Now().Add(window),
 	}
 	go rateLimiter.cleanup()
 	return rateLimiter
@@ -54,3 +86,17 @@ func (rateLimiter *RateLimiter) Allow(ip string) bool {
 	rateLimiter.attempts[ip]++
 	return true
 }
+
+// Status reports the key's attempts in the current window without counting one
+func (rateLimiter *RateLimiter) Status(key string) (count, limit int, resetAt time.Time) {
+	rateLimiter.mutex.Lock()
+	defer rateLimiter.mutex.Unlock()
+	return rateLimiter.attempts[key], rateLimiter.limit, rateLimiter.resetAt
+}
+
+// Reset clears the key's attempts, e.g. for a user locked out by mistyped passwords
+func (rateLimiter *RateLimiter) Reset(key string) {
+	rateLimiter.mutex.Lock()
+	defer rateLimiter.mutex.Unlock()
+	delete(rateLimiter.attempts, key)
+}
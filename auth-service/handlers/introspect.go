@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/chepyr/go-task-tracker/shared"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// maximum number of tokens in one /introspect/batch request
+const maxIntrospectBatchSize = 100
+
+type introspectResult struct {
+	Active bool   `json:"active"`
+	Sub    string `json:"sub,omitempty"`
+}
+
+/*
+IntrospectBatch validates a batch of tokens for a gateway in one call.
+Results are returned in the order of the submitted tokens.
+Only internal callers (shared.InternalAPIKeyHeader) may use it.
+*/
+func (handler *Handler) IntrospectBatch(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		shared.SendError(writer, "Use POST method for introspection", http.StatusMethodNotAllowed)
+		return
+	}
+	if !shared.IsInternalCaller(request, handler.InternalAPIKey) {
+		shared.SendError(writer, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	request.Body = http.MaxBytesReader(writer, request.Body, 1<<20) // 1MB
+	var input struct {
+		Tokens []string `json:"tokens"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&input); err != nil {
+		log.Printf("Error decoding JSON: %v", err)
+		shared.SendError(writer, "Bad JSON", http.StatusBadRequest)
+		return
+	}
+	if len(input.Tokens) > maxIntrospectBatchSize {
+		shared.SendError(writer,
+			fmt.Sprintf("Too many tokens (max %d)", maxIntrospectBatchSize), http.StatusBadRequest)
+		return
+	}
+
+	results := make([]introspectResult, len(input.Tokens))
+	for i, tokenString := range input.Tokens {
+		if sub, ok := handler.validateJWTToken(tokenString); ok {
+			results[i] = introspectResult{Active: true, Sub: sub}
+		}
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(writer).Encode(map[string]any{"results": results})
+}
+
+// check signature, exp and sub the same way the tasks service does
+func (handler *Handler) validateJWTToken(tokenString string) (string, bool) {
+	claims := jwt.MapClaims{}
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	token, err := parser.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (any, error) {
+		return []byte(handler.JWTSecret), nil
+	})
+	if err != nil || !token.Valid {
+		return "", false
+	}
+	if _, ok := claims["exp"].(float64); !ok {
+		return "", false
+	}
+	sub, _ := claims["sub"].(string)
+	return sub, sub != ""
+}
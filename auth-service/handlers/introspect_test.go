@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chepyr/go-task-tracker/shared"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const introspectTestKey = "internal-test-key"
+
+func introspect(t *testing.T, handler *Handler, body string, withKey bool) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/introspect/batch", bytes.NewBufferString(body))
+	if withKey {
+		req.Header.Set(shared.InternalAPIKeyHeader, introspectTestKey)
+	}
+	rec := httptest.NewRecorder()
+	handler.IntrospectBatch(rec, req)
+	return rec
+}
+
+// results stay aligned with the submitted tokens
+func TestIntrospectBatch_MixedTokens(t *testing.T) {
+	secret := testJWTSecret
+	handler := &Handler{InternalAPIKey: introspectTestKey, JWTSecret: secret}
+
+	valid, err := handler.generateJWTToken("user-1")
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+	expired, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "user-2",
+		"exp": time.Now().Add(-time.Hour).Unix(),
+	}).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatalf("sign expired token: %v", err)
+	}
+	otherSecret, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "user-3",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte("another-secret-32-bytes-long-12345"))
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+
+	tokens := []string{expired, valid, "not.a.jwt", otherSecret, ""}
+	body, _ := json.Marshal(map[string]any{"tokens": tokens})
+	rec := introspect(t, handler, string(body), true)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp struct {
+		Results []introspectResult `json:"results"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	want := []introspectResult{{}, {Active: true, Sub: "user-1"}, {}, {}, {}}
+	if len(resp.Results) != len(want) {
+		t.Fatalf("Expected %d results, got %d", len(want), len(resp.Results))
+	}
+	for i := range want {
+		if resp.Results[i] != want[i] {
+			t.Errorf("result %d: expected %+v, got %+v", i, want[i], resp.Results[i])
+		}
+	}
+}
+
+func TestIntrospectBatch_Rejections(t *testing.T) {
+	handler := &Handler{InternalAPIKey: introspectTestKey, JWTSecret: testJWTSecret}
+
+	if rec := introspect(t, handler, `{"tokens":[]}`, false); rec.Code != http.StatusForbidden {
+		t.Errorf("without internal key: expected 403, got %d", rec.Code)
+	}
+
+	tokens := make([]string, maxIntrospectBatchSize+1)
+	for i := range tokens {
+		tokens[i] = fmt.Sprintf("token-%d", i)
+	}
+	body, _ := json.Marshal(map[string]any{"tokens": tokens})
+	rec := introspect(t, handler, string(body), true)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "Too many tokens") {
+		t.Errorf("oversized batch: expected 400, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if rec := introspect(t, handler, `{"tokens":`, true); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad JSON: expected 400, got %d", rec.Code)
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"os"
 	"time"
 
 	"github.com/chepyr/go-task-tracker/shared"
@@ -21,9 +20,8 @@ func (handler *Handler) Login(writer http.ResponseWriter, request *http.Request)
 		return
 	}
 
-	clientIP := request.RemoteAddr
-	if handler.RateLimiter != nil && !handler.RateLimiter.Allow(clientIP) {
-		log.Printf("Rate limit exceeded for IP: %s", clientIP)
+	if !handler.allowRequest(request) {
+		log.Printf("Rate limit exceeded for IP: %s", clientIP(request))
 		shared.SendError(writer, "Too many login attempts. Please try again later.", http.StatusTooManyRequests)
 		return
 	}
@@ -32,7 +30,7 @@ func (handler *Handler) Login(writer http.ResponseWriter, request *http.Request)
 		Email    string `json:"email"`
 		Password string `json:"password"`
 	}
-	if err := json.NewDecoder(request.Body).Decode(&input); err != nil {
+	if err := shared.DecodeJSON(request.Body, &input, handler.AllowTrailingJSON); err != nil {
 		log.Printf("Error decoding JSON: %v", err)
 		shared.SendError(writer, "Bad JSON", http.StatusBadRequest)
 		return
@@ -57,36 +55,46 @@ func (handler *Handler) Login(writer http.ResponseWriter, request *http.Request)
 		return
 	}
 
-	tokenString, err := generateJWTToken(user.ID.String())
+	tokenString, err := handler.generateJWTToken(user.ID.String())
 	if err != nil {
 		log.Printf("Error generating token: %v", err)
 		shared.SendError(writer, "Cannot create token", http.StatusInternalServerError)
 		return
 	}
 
-	writer.Header().Set("Content-Type", "application/json")
-	writer.WriteHeader(http.StatusOK)
-	json.NewEncoder(writer).Encode(map[string]any{
+	response := map[string]any{
 		"user_email": input.Email,
 		"user_id":    user.ID,
 		"token":      tokenString,
-	})
+	}
+	if handler.RefreshTokens != nil {
+		refreshToken, err := handler.RefreshTokens.Issue(request.Context(), user.ID)
+		if err != nil {
+			log.Printf("Error generating refresh token: %v", err)
+			shared.SendError(writer, "Cannot create token", http.StatusInternalServerError)
+			return
+		}
+		response["refresh_token"] = refreshToken
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(http.StatusOK)
+	json.NewEncoder(writer).Encode(response)
 	log.Printf("User logged in: %s", input.Email)
 }
 
-func generateJWTToken(sub string) (string, error) {
+func (handler *Handler) generateJWTToken(sub string) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"sub": sub,
 		"exp": time.Now().Add(24 * time.Hour).Unix(),
 		"iat": time.Now().Unix(),
 	})
 
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		return "", fmt.Errorf("JWT_SECRET environment variable is not set")
+	if handler.JWTSecret == "" {
+		return "", fmt.Errorf("JWT secret is not configured")
 	}
 
-	tokenString, err := token.SignedString([]byte(jwtSecret))
+	tokenString, err := token.SignedString([]byte(handler.JWTSecret))
 	if err != nil {
 		return "", fmt.Errorf("error signing token: %w", err)
 	}
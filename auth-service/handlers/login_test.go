@@ -5,16 +5,21 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/chepyr/go-task-tracker/shared"
 	"github.com/chepyr/go-task-tracker/shared/models"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
 
+const testJWTSecret = "test-secret-32-bytes-long-1234567890"
+
 func TestLogin(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -22,7 +27,7 @@ func TestLogin(t *testing.T) {
 		body           string
 		mockRepo       *MockUserRepository
 		rateLimitAllow bool
-		setEnv         bool
+		withSecret     bool
 		expectedStatus int
 		expectedBody   string
 	}{
@@ -32,7 +37,7 @@ func TestLogin(t *testing.T) {
 			body:           `{"email": "test@example.com", "password": "strongpass"}`,
 			mockRepo:       setupMockUser("test@example.com", "strongpass"),
 			rateLimitAllow: true,
-			setEnv:         true,
+			withSecret:     true,
 			expectedStatus: http.StatusOK,
 			expectedBody:   `"user_email":"test@example.com"`,
 		},
@@ -42,7 +47,7 @@ func TestLogin(t *testing.T) {
 			body:           ``,
 			mockRepo:       NewMockUserRepository(),
 			rateLimitAllow: true,
-			setEnv:         true,
+			withSecret:     true,
 			expectedStatus: http.StatusMethodNotAllowed,
 			expectedBody:   `"error":"Use POST method for login"`,
 		},
@@ -52,7 +57,17 @@ func TestLogin(t *testing.T) {
 			body:           `{"email": "test@example.com", "password": }`,
 			mockRepo:       NewMockUserRepository(),
 			rateLimitAllow: true,
-			setEnv:         true,
+			withSecret:     true,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `"error":"Bad JSON"`,
+		},
+		{
+			name:           "Trailing JSON",
+			method:         http.MethodPost,
+			body:           `{"email": "test@example.com", "password": "strongpass"}{"email": "other@example.com"}`,
+			mockRepo:       setupMockUser("test@example.com", "strongpass"),
+			rateLimitAllow: true,
+			withSecret:     true,
 			expectedStatus: http.StatusBadRequest,
 			expectedBody:   `"error":"Bad JSON"`,
 		},
@@ -62,7 +77,7 @@ func TestLogin(t *testing.T) {
 			body:           `{"email": "invalid", "password": "strongpass"}`,
 			mockRepo:       NewMockUserRepository(),
 			rateLimitAllow: true,
-			setEnv:         true,
+			withSecret:     true,
 			expectedStatus: http.StatusBadRequest,
 			expectedBody:   `"error":"Invalid email"`,
 		},
@@ -72,7 +87,7 @@ func TestLogin(t *testing.T) {
 			body:           `{"email": "test@example.com", "password": "abc"}`,
 			mockRepo:       NewMockUserRepository(),
 			rateLimitAllow: true,
-			setEnv:         true,
+			withSecret:     true,
 			expectedStatus: http.StatusBadRequest,
 			expectedBody:   `"error":"Password must be at least 4 characters long"`,
 		},
@@ -82,7 +97,7 @@ func TestLogin(t *testing.T) {
 			body:           `{"email": "test@example.com", "password": "strongpass"}`,
 			mockRepo:       NewMockUserRepository(),
 			rateLimitAllow: false,
-			setEnv:         true,
+			withSecret:     true,
 			expectedStatus: http.StatusTooManyRequests,
 			expectedBody:   `"error":"Too many login attempts`,
 		},
@@ -92,7 +107,7 @@ func TestLogin(t *testing.T) {
 			body:           `{"email": "test@example.com", "password": "strongpass"}`,
 			mockRepo:       NewMockUserRepository(),
 			rateLimitAllow: true,
-			setEnv:         true,
+			withSecret:     true,
 			expectedStatus: http.StatusUnauthorized,
 			expectedBody:   `"error":"Invalid email or password"`,
 		},
@@ -102,17 +117,17 @@ func TestLogin(t *testing.T) {
 			body:           `{"email": "test@example.com", "password": "wrongpass"}`,
 			mockRepo:       setupMockUser("test@example.com", "strongpass"),
 			rateLimitAllow: true,
-			setEnv:         true,
+			withSecret:     true,
 			expectedStatus: http.StatusUnauthorized,
 			expectedBody:   `"error":"Invalid email or password"`,
 		},
 		{
-			name:           "Missing JWT_SECRET",
+			name:           "Missing JWT secret",
 			method:         http.MethodPost,
 			body:           `{"email": "test@example.com", "password": "strongpass"}`,
 			mockRepo:       setupMockUser("test@example.com", "strongpass"),
 			rateLimitAllow: true,
-			setEnv:         false,
+			withSecret:     false,
 			expectedStatus: http.StatusInternalServerError,
 			expectedBody:   `"error":"Cannot create token"`,
 		},
@@ -120,12 +135,6 @@ func TestLogin(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if tt.setEnv {
-				os.Setenv("JWT_SECRET", "test-secret-32-bytes-long-1234567890")
-			} else {
-				os.Unsetenv("JWT_SECRET")
-			}
-
 			rl := NewRateLimiter(5, 1*time.Second)
 			if !tt.rateLimitAllow {
 				for i := 0; i < 5; i++ {
@@ -133,6 +142,9 @@ func TestLogin(t *testing.T) {
 				}
 			}
 			handler := &Handler{UserRepo: tt.mockRepo, RateLimiter: rl}
+			if tt.withSecret {
+				handler.JWTSecret = testJWTSecret
+			}
 
 			req := httptest.NewRequest(tt.method, "/login", bytes.NewBufferString(tt.body))
 			req.RemoteAddr = "192.168.1.1"
@@ -166,8 +178,7 @@ func setupMockUser(email, password string) *MockUserRepository {
 func TestLoginConcurrent(t *testing.T) {
 	repo := setupMockUser("test@example.com", "strongpass")
 	rl := NewRateLimiter(3, 100*time.Millisecond)
-	handler := &Handler{UserRepo: repo, RateLimiter: rl}
-	os.Setenv("JWT_SECRET", "test-secret-32-bytes-long-1234567890")
+	handler := &Handler{UserRepo: repo, RateLimiter: rl, JWTSecret: testJWTSecret}
 
 	var wg sync.WaitGroup
 	results := make([]int, 5)
@@ -194,3 +205,92 @@ func TestLoginConcurrent(t *testing.T) {
 		t.Errorf("Expected at most 3 successes, got %d", allowed)
 	}
 }
+
+// secret is loaded from JWT_SECRET_FILE (trimmed, preferred over JWT_SECRET)
+// and the minted token validates against it
+func TestGenerateJWTToken_SecretFromFile(t *testing.T) {
+	secret := "file-secret-32-bytes-long-1234567890"
+	path := filepath.Join(t.TempDir(), "jwt_secret")
+	if err := os.WriteFile(path, []byte(secret+"\n"), 0o600); err != nil {
+		t.Fatalf("write secret file: %v", err)
+	}
+	t.Setenv("JWT_SECRET_FILE", path)
+	t.Setenv("JWT_SECRET", "env-secret-32-bytes-long-1234567890")
+
+	loaded, err := shared.LoadJWTSecret(shared.MinJWTSecretLength)
+	if err != nil {
+		t.Fatalf("LoadJWTSecret: %v", err)
+	}
+	if loaded != secret {
+		t.Fatalf("Expected secret from file %q, got %q", secret, loaded)
+	}
+	handler := &Handler{JWTSecret: loaded}
+
+	sub := uuid.New().String()
+	tokenString, err := handler.generateJWTToken(sub)
+	if err != nil {
+		t.Fatalf("generateJWTToken: %v", err)
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(tokenString, claims, func(*jwt.Token) (any, error) {
+		return []byte(secret), nil
+	})
+	if err != nil {
+		t.Fatalf("Token does not validate with the file secret: %v", err)
+	}
+	if claims["sub"] != sub {
+		t.Errorf("Expected sub %q, got %v", sub, claims["sub"])
+	}
+
+	// the same length validation applies to the file
+	if err := os.WriteFile(path, []byte("short\n"), 0o600); err != nil {
+		t.Fatalf("write secret file: %v", err)
+	}
+	if _, err := shared.LoadJWTSecret(shared.MinJWTSecretLength); err == nil {
+		t.Error("Expected error for short secret in file, got nil")
+	}
+}
+
+// a request bearing the internal API key bypasses an exhausted limiter,
+// a wrong key is limited as usual
+func TestLogin_InternalAPIKeyBypassesRateLimit(t *testing.T) {
+	const internalKey = "internal-key-for-tests"
+
+	rl := NewRateLimiter(1, time.Minute)
+	rl.Allow("192.168.1.1") // exhaust the limit
+	handler := &Handler{
+		UserRepo:       setupMockUser("test@example.com", "strongpass"),
+		RateLimiter:    rl,
+		InternalAPIKey: internalKey,
+		JWTSecret:      testJWTSecret,
+	}
+
+	tests := []struct {
+		name           string
+		key            string
+		expectedStatus int
+	}{
+		{name: "Valid internal key", key: internalKey, expectedStatus: http.StatusOK},
+		{name: "Invalid internal key", key: "wrong-key", expectedStatus: http.StatusTooManyRequests},
+		{name: "No internal key", key: "", expectedStatus: http.StatusTooManyRequests},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/login",
+				strings.NewReader(`{"email": "test@example.com", "password": "strongpass"}`))
+			req.RemoteAddr = "192.168.1.1"
+			if tt.key != "" {
+				req.Header.Set(shared.InternalAPIKeyHeader, tt.key)
+			}
+			rr := httptest.NewRecorder()
+
+			handler.Login(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d, body: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/chepyr/go-task-tracker/shared"
+)
+
+/*
+handles routes for the /register, /login and /refresh limiter:
+- GET /ratelimit/status - the caller's bucket
+- DELETE /ratelimit/{key} - internal callers only, clear a bucket
+*/
+func (handler *Handler) HandleRateLimit(writer http.ResponseWriter, request *http.Request) {
+	key := strings.TrimPrefix(request.URL.Path, "/ratelimit/")
+	switch {
+	case key == "status" && request.Method == http.MethodGet:
+		handler.rateLimitStatus(writer, request)
+	case key != "" && key != "status" && request.Method == http.MethodDelete:
+		if !shared.IsInternalCaller(request, handler.InternalAPIKey) {
+			shared.SendError(writer, "Forbidden", http.StatusForbidden)
+			return
+		}
+		handler.RateLimiter.Reset(key)
+		writer.WriteHeader(http.StatusNoContent)
+	case key == "":
+		shared.SendError(writer, "Not found", http.StatusNotFound)
+	default:
+		shared.SendError(writer, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// the bucket is keyed by the remote host, like in allowRequest
+func (handler *Handler) rateLimitStatus(writer http.ResponseWriter, request *http.Request) {
+	key := clientIP(request)
+	count, limit, resetAt := handler.RateLimiter.Status(key)
+
+	writer.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(writer).Encode(struct {
+		Key       string    `json:"key"`
+		Count     int       `json:"count"`
+		Limit     int       `json:"limit"`
+		Remaining int       `json:"remaining"`
+		ResetAt   time.Time `json:"reset_at"`
+	}{key, count, limit, max(limit-count, 0), resetAt.UTC()})
+}
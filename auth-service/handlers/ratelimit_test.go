@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/chepyr/go-task-tracker/shared"
+)
+
+// status shows the caller's login attempts, and only internal callers may clear them
+func TestHandleRateLimit(t *testing.T) {
+	const internalKey = "internal-key-for-tests"
+	rl := NewRateLimiter(5, time.Minute)
+	handler := &Handler{RateLimiter: rl, InternalAPIKey: internalKey}
+	rl.Allow("192.168.1.1")
+	rl.Allow("192.168.1.1")
+
+	status := func() (count, remaining int) {
+		req := httptest.NewRequest(http.MethodGet, "/ratelimit/status", nil)
+		req.RemoteAddr = "192.168.1.1"
+		rr := httptest.NewRecorder()
+		handler.HandleRateLimit(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("status: want 200, got %d", rr.Code)
+		}
+		var resp struct {
+			Count     int `json:"count"`
+			Remaining int `json:"remaining"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp.Count, resp.Remaining
+	}
+	reset := func(key string) int {
+		req := httptest.NewRequest(http.MethodDelete, "/ratelimit/192.168.1.1", nil)
+		if key != "" {
+			req.Header.Set(shared.InternalAPIKeyHeader, key)
+		}
+		rr := httptest.NewRecorder()
+		handler.HandleRateLimit(rr, req)
+		return rr.Code
+	}
+
+	if count, remaining := status(); count != 2 || remaining != 3 {
+		t.Fatalf("want count 2 and remaining 3, got %d and %d", count, remaining)
+	}
+	if code := reset(""); code != http.StatusForbidden {
+		t.Fatalf("reset without internal key: want 403, got %d", code)
+	}
+	if code := reset(internalKey); code != http.StatusNoContent {
+		t.Fatalf("reset: want 204, got %d", code)
+	}
+	if count, _ := status(); count != 0 {
+		t.Fatalf("want count 0 after reset, got %d", count)
+	}
+}
+
+// each connection has its own port, so the bucket is keyed by the host alone
+func TestHandleRateLimit_KeyIgnoresPort(t *testing.T) {
+	rl := NewRateLimiter(2, time.Minute)
+	handler := &Handler{RateLimiter: rl}
+	fromPort := func(method, path, port string) *http.Request {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = "10.0.0.7:" + port
+		return req
+	}
+
+	if !handler.allowRequest(fromPort(http.MethodPost, "/login", "50001")) ||
+		!handler.allowRequest(fromPort(http.MethodPost, "/login", "50002")) {
+		t.Fatalf("first two requests should be allowed")
+	}
+	if handler.allowRequest(fromPort(http.MethodPost, "/login", "50003")) {
+		t.Fatalf("a new connection from the same host should be throttled")
+	}
+
+	rr := httptest.NewRecorder()
+	handler.HandleRateLimit(rr, fromPort(http.MethodGet, "/ratelimit/status", "50004"))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status: want 200, got %d", rr.Code)
+	}
+	var resp struct {
+		Key       string `json:"key"`
+		Count     int    `json:"count"`
+		Remaining int    `json:"remaining"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Key != "10.0.0.7" || resp.Count != 2 || resp.Remaining != 0 {
+		t.Fatalf("want key 10.0.0.7 with count 2 and remaining 0, got %+v", resp)
+	}
+}
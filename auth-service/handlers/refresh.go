@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/chepyr/go-task-tracker/auth-service/db"
+	"github.com/chepyr/go-task-tracker/shared"
+	"github.com/chepyr/go-task-tracker/shared/models"
+	"github.com/google/uuid"
+)
+
+/*
+RefreshTokenStore issues refresh tokens and rotates them on every use.
+Tokens are kept in the auth database, so they survive restarts and are shared by replicas.
+A rotated token is normally rejected. With a GraceWindow, the immediately
+previous token is accepted once more within the window after its rotation,
+so a client racing two refreshes isn't logged out. Off (zero) by default.
+*/
+type RefreshTokenStore struct {
+	repo        *db.RefreshTokenRepository
+	ttl         time.Duration
+	GraceWindow time.Duration
+}
+
+func NewRefreshTokenStore(repo *db.RefreshTokenRepository, ttl time.Duration) *RefreshTokenStore {
+	store := &RefreshTokenStore{repo: repo, ttl: ttl}
+	go store.cleanup()
+	return store
+}
+
+// Issue creates a new refresh token for the user
+func (store *RefreshTokenStore) Issue(ctx context.Context, userID uuid.UUID) (string, error) {
+	token, record, err := store.newToken()
+	if err != nil {
+		return "", err
+	}
+	record.UserID = userID
+	if err := store.repo.Create(ctx, record); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Rotate exchanges a refresh token for a new one and returns its user
+func (store *RefreshTokenStore) Rotate(ctx context.Context, token string) (userID uuid.UUID, newToken string, err error) {
+	newToken, record, err := store.newToken()
+	if err != nil {
+		return uuid.Nil, "", err
+	}
+	userID, err = store.repo.Rotate(ctx, hashRefreshToken(token), record, store.GraceWindow)
+	if err != nil {
+		return uuid.Nil, "", err
+	}
+	return userID, newToken, nil
+}
+
+// a random token and its record, only the hash of the token is stored
+func (store *RefreshTokenStore) newToken() (string, *models.RefreshToken, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", nil, err
+	}
+	token := hex.EncodeToString(buf)
+	now := time.Now().UTC()
+	return token, &models.RefreshToken{
+		TokenHash: hashRefreshToken(token),
+		ExpiresAt: now.Add(store.ttl),
+		CreatedAt: now,
+	}, nil
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// drop expired tokens and rotated tokens past their grace window
+func (store *RefreshTokenStore) cleanup() {
+	for range time.Tick(10 * time.Minute) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		if _, err := store.repo.DeleteExpired(ctx, time.Now().UTC(), store.GraceWindow); err != nil {
+			log.Printf("Error deleting expired refresh tokens: %v", err)
+		}
+		cancel()
+	}
+}
+
+// POST /refresh - exchange a refresh token for a new access and refresh token
+func (handler *Handler) Refresh(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		shared.SendError(writer, "Use POST method for refresh", http.StatusMethodNotAllowed)
+		return
+	}
+	if handler.RefreshTokens == nil {
+		shared.SendError(writer, "Refresh tokens are disabled", http.StatusNotFound)
+		return
+	}
+
+	if !handler.allowRequest(request) {
+		log.Printf("Rate limit exceeded for IP: %s", clientIP(request))
+		shared.SendError(writer, "Too many refresh attempts. Please try again later.", http.StatusTooManyRequests)
+		return
+	}
+
+	request.Body = http.MaxBytesReader(writer, request.Body, 1<<20) // 1MB
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&input); err != nil {
+		log.Printf("Error decoding JSON: %v", err)
+		shared.SendError(writer, "Bad JSON", http.StatusBadRequest)
+		return
+	}
+
+	userID, refreshToken, err := handler.RefreshTokens.Rotate(request.Context(), input.RefreshToken)
+	if errors.Is(err, db.ErrInvalidRefreshToken) {
+		shared.SendError(writer, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		log.Printf("Error rotating refresh token: %v", err)
+		shared.SendError(writer, "Cannot refresh token", http.StatusInternalServerError)
+		return
+	}
+	tokenString, err := handler.generateJWTToken(userID.String())
+	if err != nil {
+		log.Printf("Error generating token: %v", err)
+		shared.SendError(writer, "Cannot create token", http.StatusInternalServerError)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(writer).Encode(map[string]any{
+		"user_id":       userID,
+		"token":         tokenString,
+		"refresh_token": refreshToken,
+	})
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chepyr/go-task-tracker/auth-service/db"
+	"github.com/google/uuid"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// a refresh token store backed by an in-memory database
+func newTestRefreshTokenStore(t *testing.T) *RefreshTokenStore {
+	t.Helper()
+	dbx, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	// every connection to :memory: is a separate database
+	dbx.SetMaxOpenConns(1)
+	t.Cleanup(func() { dbx.Close() })
+
+	_, err = dbx.Exec(`CREATE TABLE refresh_tokens (
+		token_hash VARCHAR(64) PRIMARY KEY,
+		user_id TEXT NOT NULL,
+		expires_at TIMESTAMP NOT NULL,
+		rotated_at TIMESTAMP,
+		successor_hash VARCHAR(64),
+		grace_used BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		t.Fatalf("create refresh_tokens: %v", err)
+	}
+	return NewRefreshTokenStore(db.NewRefreshTokenRepository(dbx), time.Hour)
+}
+
+func refresh(handler *Handler, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/refresh",
+		strings.NewReader(`{"refresh_token": "`+token+`"}`))
+	rr := httptest.NewRecorder()
+	handler.Refresh(rr, req)
+	return rr
+}
+
+// two refreshes racing with the same token
+func concurrentRefresh(t *testing.T, handler *Handler, token string) []int {
+	t.Helper()
+	var wg sync.WaitGroup
+	codes := make([]int, 2)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = refresh(handler, token).Code
+		}(i)
+	}
+	wg.Wait()
+	return codes
+}
+
+func TestLogin_IssuesRefreshToken(t *testing.T) {
+	handler := &Handler{
+		UserRepo:      setupMockUser("test@example.com", "strongpass"),
+		RefreshTokens: newTestRefreshTokenStore(t),
+		JWTSecret:     testJWTSecret,
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/login",
+		strings.NewReader(`{"email": "test@example.com", "password": "strongpass"}`))
+	rr := httptest.NewRecorder()
+	handler.Login(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var resp struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || resp.RefreshToken == "" {
+		t.Fatalf("Expected refresh_token in response, got %s", rr.Body.String())
+	}
+
+	rr = refresh(handler, resp.RefreshToken)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"token"`) {
+		t.Fatalf("Expected new tokens, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestRefresh_ConcurrentWithGraceWindow(t *testing.T) {
+	store := newTestRefreshTokenStore(t)
+	store.GraceWindow = 10 * time.Second
+	handler := &Handler{RefreshTokens: store, JWTSecret: testJWTSecret}
+
+	token, err := store.Issue(context.Background(), uuid.New())
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	for i, code := range concurrentRefresh(t, handler, token) {
+		if code != http.StatusOK {
+			t.Errorf("refresh %d: expected 200 under grace window, got %d", i, code)
+		}
+	}
+
+	// the grace is used up, a third use is rejected
+	if rr := refresh(handler, token); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 on reuse after grace, got %d", rr.Code)
+	}
+}
+
+func TestRefresh_ConcurrentWithoutGraceWindow(t *testing.T) {
+	store := newTestRefreshTokenStore(t)
+	handler := &Handler{RefreshTokens: store, JWTSecret: testJWTSecret}
+
+	token, err := store.Issue(context.Background(), uuid.New())
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	codes := concurrentRefresh(t, handler, token)
+	ok, rejected := 0, 0
+	for _, code := range codes {
+		switch code {
+		case http.StatusOK:
+			ok++
+		case http.StatusUnauthorized:
+			rejected++
+		}
+	}
+	if ok != 1 || rejected != 1 {
+		t.Errorf("Expected one success and one 401, got %v", codes)
+	}
+}
+
+func TestRefresh_GraceWindowExpires(t *testing.T) {
+	ctx := context.Background()
+	store := newTestRefreshTokenStore(t)
+	store.GraceWindow = 10 * time.Millisecond
+
+	token, _ := store.Issue(ctx, uuid.New())
+	if _, _, err := store.Rotate(ctx, token); err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, _, err := store.Rotate(ctx, token); err == nil {
+		t.Errorf("Expected rotated token to be rejected after the grace window")
+	}
+	if _, _, err := store.Rotate(ctx, "unknown"); err == nil {
+		t.Errorf("Expected unknown token to be rejected")
+	}
+}
+
+func TestRefresh_RateLimited(t *testing.T) {
+	handler := &Handler{
+		RefreshTokens: newTestRefreshTokenStore(t),
+		RateLimiter:   NewRateLimiter(1, time.Minute),
+		JWTSecret:     testJWTSecret,
+	}
+
+	if rr := refresh(handler, "unknown"); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 for an unknown token, got %d", rr.Code)
+	}
+	if rr := refresh(handler, "unknown"); rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429 over the limit, got %d", rr.Code)
+	}
+}
+
+func TestRefresh_BodyTooLarge(t *testing.T) {
+	handler := &Handler{RefreshTokens: newTestRefreshTokenStore(t)}
+
+	body := `{"refresh_token": "` + strings.Repeat("a", 2<<20) + `"}`
+	req := httptest.NewRequest(http.MethodPost, "/refresh", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	handler.Refresh(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 for an oversized body, got %d", rr.Code)
+	}
+}
@@ -21,9 +21,8 @@ func (handler *Handler) Register(writer http.ResponseWriter, request *http.Reque
 		return
 	}
 
-	clientIP := request.RemoteAddr
-	if handler.RateLimiter != nil && !handler.RateLimiter.Allow(clientIP) {
-		log.Printf("Rate limit exceeded for IP: %s", clientIP)
+	if !handler.allowRequest(request) {
+		log.Printf("Rate limit exceeded for IP: %s", clientIP(request))
 		shared.SendError(writer, "Too many register attempts. Please try again later.", http.StatusTooManyRequests)
 		return
 	}
@@ -32,7 +31,7 @@ func (handler *Handler) Register(writer http.ResponseWriter, request *http.Reque
 		Email    string `json:"email"`
 		Password string `json:"password"`
 	}
-	if err := json.NewDecoder(request.Body).Decode(&input); err != nil {
+	if err := shared.DecodeJSON(request.Body, &input, handler.AllowTrailingJSON); err != nil {
 		log.Printf("Error decoding JSON: %v", err)
 		shared.SendError(writer, "Bad JSON", http.StatusBadRequest)
 		return
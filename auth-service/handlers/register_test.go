@@ -47,6 +47,14 @@ func TestRegister(t *testing.T) {
 			expectedStatus: http.StatusBadRequest,
 			expectedBody:   `"error":"Bad JSON"`,
 		},
+		{
+			name:           "Trailing JSON",
+			method:         http.MethodPost,
+			body:           `{"email": "test@example.com", "password": "strongpass"}{"email": "other@example.com"}`,
+			mockRepo:       NewMockUserRepository(),
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `"error":"Bad JSON"`,
+		},
 		{
 			name:           "Invalid email format",
 			method:         http.MethodPost,
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"sync"
 	"time"
@@ -50,6 +51,21 @@ func (m *MockUserRepository) GetByEmail(ctx context.Context, email string) (*mod
 	return user, nil
 }
 
+func (m *MockUserRepository) GetByID(ctx context.Context, id string) (*models.User, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.getErr != nil {
+		return nil, m.getErr
+	}
+	for _, user := range m.users {
+		if user.ID.String() == id {
+			return user, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
 func SetupMockUser(email, password string) *MockUserRepository {
 	repo := NewMockUserRepository()
 	hash, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/chepyr/go-task-tracker/shared"
+	"github.com/google/uuid"
+)
+
+/*
+GET /users/{id} - lets other services check that a user exists.
+Only internal callers (shared.InternalAPIKeyHeader) may use it.
+Returns the user's id and email, or 404.
+*/
+func (handler *Handler) GetUser(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		shared.SendError(writer, "Use GET method for users", http.StatusMethodNotAllowed)
+		return
+	}
+	if !shared.IsInternalCaller(request, handler.InternalAPIKey) {
+		shared.SendError(writer, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	id, err := uuid.Parse(strings.TrimPrefix(request.URL.Path, "/users/"))
+	if err != nil {
+		shared.SendError(writer, "Invalid user id", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(request.Context(), 5*time.Second)
+	defer cancel()
+
+	user, err := handler.UserRepo.GetByID(ctx, id.String())
+	if errors.Is(err, sql.ErrNoRows) {
+		shared.SendError(writer, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error retrieving user %s: %v", id, err)
+		shared.SendError(writer, "Cannot load user", http.StatusInternalServerError)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(writer).Encode(map[string]any{
+		"user_id":    user.ID,
+		"user_email": user.Email,
+	})
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/chepyr/go-task-tracker/shared"
+	"github.com/google/uuid"
+)
+
+func TestGetUser(t *testing.T) {
+	const internalKey = "internal-key-for-tests"
+	repo := setupMockUser("test@example.com", "strongpass")
+	handler := &Handler{UserRepo: repo, InternalAPIKey: internalKey}
+	userID := repo.users["test@example.com"].ID.String()
+
+	tests := []struct {
+		name           string
+		path           string
+		key            string
+		expectedStatus int
+	}{
+		{name: "Existing user", path: "/users/" + userID, key: internalKey, expectedStatus: http.StatusOK},
+		{name: "Unknown user", path: "/users/" + uuid.New().String(), key: internalKey, expectedStatus: http.StatusNotFound},
+		{name: "Invalid id", path: "/users/not-a-uuid", key: internalKey, expectedStatus: http.StatusBadRequest},
+		{name: "Without internal key", path: "/users/" + userID, key: "", expectedStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.key != "" {
+				req.Header.Set(shared.InternalAPIKeyHeader, tt.key)
+			}
+			rr := httptest.NewRecorder()
+			handler.GetUser(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tt.expectedStatus == http.StatusOK && !strings.Contains(rr.Body.String(), userID) {
+				t.Errorf("Expected user id in response, got %s", rr.Body.String())
+			}
+		})
+	}
+}
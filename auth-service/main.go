@@ -13,11 +13,12 @@ import (
 
 	"github.com/chepyr/go-task-tracker/auth-service/db"
 	"github.com/chepyr/go-task-tracker/auth-service/handlers"
+	"github.com/chepyr/go-task-tracker/shared"
 	_ "github.com/lib/pq"
 )
 
 func main() {
-	validateEnv()
+	jwtSecret := validateEnv()
 	dbConn := initDB()
 
 	defer func() {
@@ -26,13 +27,14 @@ func main() {
 		}
 	}()
 
-	initHandlers(dbConn)
+	initHandlers(dbConn, jwtSecret)
 
 	server := initServer()
 	startServer(server)
 }
 
-func validateEnv() {
+// returns the JWT secret, loaded from JWT_SECRET or JWT_SECRET_FILE
+func validateEnv() string {
 	requiredEnvVars := []string{
 		"POSTGRES_USER", "POSTGRES_PASSWORD", "POSTGRES_DB",
 		"POSTGRES_HOST", "POSTGRES_PORT", "SERVER_PORT",
@@ -42,9 +44,12 @@ func validateEnv() {
 			log.Fatalf("Environment variable %s must be set", env)
 		}
 	}
-	if len(os.Getenv("JWT_SECRET")) < 32 {
-		log.Fatal("JWT_SECRET must be at least 32 characters")
+
+	secret, err := shared.LoadJWTSecret(shared.MinJWTSecretLength)
+	if err != nil {
+		log.Fatalf("Invalid JWT secret: %v", err)
 	}
+	return secret
 }
 
 func initDB() *sql.DB {
@@ -65,14 +70,34 @@ func initDB() *sql.DB {
 	return dbConn
 }
 
-func initHandlers(dbConn *sql.DB) {
+func initHandlers(dbConn *sql.DB, jwtSecret string) {
+	refreshTokens := handlers.NewRefreshTokenStore(db.NewRefreshTokenRepository(dbConn), 30*24*time.Hour)
+	// lets the previous refresh token be used once more after rotation, off by default
+	if grace := os.Getenv("REFRESH_GRACE_PERIOD"); grace != "" {
+		window, err := time.ParseDuration(grace)
+		if err != nil || window < 0 {
+			log.Fatalf("Environment variable REFRESH_GRACE_PERIOD must be a duration like 10s")
+		}
+		refreshTokens.GraceWindow = window
+	}
+
 	handler := &handlers.Handler{
 		UserRepo: db.NewUserRepository(dbConn),
 		// allow max 5 login attempts per 15 minutes from the same IP
 		RateLimiter: handlers.NewRateLimiter(5, 15*time.Minute),
+
+		JWTSecret:      jwtSecret,
+		InternalAPIKey: os.Getenv("INTERNAL_API_KEY"),
+		RefreshTokens:  refreshTokens,
+
+		AllowTrailingJSON: os.Getenv("ALLOW_TRAILING_JSON") == "true",
 	}
 	http.HandleFunc("/register", handler.Register)
 	http.HandleFunc("/login", handler.Login)
+	http.HandleFunc("/refresh", handler.Refresh)
+	http.HandleFunc("/introspect/batch", handler.IntrospectBatch)
+	http.HandleFunc("/users/", handler.GetUser)
+	http.HandleFunc("/ratelimit/", handler.HandleRateLimit)
 }
 
 func initServer() *http.Server {
@@ -82,6 +107,7 @@ func initServer() *http.Server {
 		ReadTimeout:       10 * time.Second,
 		WriteTimeout:      15 * time.Second,
 		IdleTimeout:       60 * time.Second,
+		Handler:           shared.Recover(http.DefaultServeMux),
 	}
 }
 
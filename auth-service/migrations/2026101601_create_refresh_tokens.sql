@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE TABLE refresh_tokens (
+    token_hash VARCHAR(64) PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP NOT NULL,
+    rotated_at TIMESTAMP,
+    successor_hash VARCHAR(64),
+    grace_used BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX idx_refresh_tokens_expires_at ON refresh_tokens(expires_at);
+
+-- +goose Down
+DROP INDEX idx_refresh_tokens_expires_at;
+DROP TABLE refresh_tokens;
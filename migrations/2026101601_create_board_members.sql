@@ -0,0 +1,14 @@
+-- +goose Up
+CREATE TABLE board_members (
+    board_id UUID NOT NULL REFERENCES boards(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL,
+    role VARCHAR(20) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (board_id, user_id)
+);
+CREATE INDEX idx_board_members_user_id ON board_members(user_id);
+
+
+-- +goose Down
+DROP INDEX idx_board_members_user_id;
+DROP TABLE board_members;
@@ -0,0 +1,8 @@
+-- +goose Up
+ALTER TABLE tasks ADD COLUMN external_ref VARCHAR(100);
+CREATE INDEX idx_tasks_board_id_external_ref ON tasks(board_id, external_ref);
+
+
+-- +goose Down
+DROP INDEX idx_tasks_board_id_external_ref;
+ALTER TABLE tasks DROP COLUMN external_ref;
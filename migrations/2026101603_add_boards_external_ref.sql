@@ -0,0 +1,8 @@
+-- +goose Up
+ALTER TABLE boards ADD COLUMN external_ref VARCHAR(100);
+CREATE UNIQUE INDEX idx_boards_owner_id_external_ref ON boards(owner_id, external_ref);
+
+
+-- +goose Down
+DROP INDEX idx_boards_owner_id_external_ref;
+ALTER TABLE boards DROP COLUMN external_ref;
@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE TABLE task_status_history (
+    id UUID PRIMARY KEY,
+    task_id UUID NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    from_status VARCHAR(20) NOT NULL,
+    to_status VARCHAR(20) NOT NULL,
+    changed_by UUID NOT NULL,
+    changed_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+CREATE INDEX idx_task_status_history_task_id ON task_status_history(task_id);
+
+
+-- +goose Down
+DROP INDEX idx_task_status_history_task_id;
+DROP TABLE task_status_history;
@@ -0,0 +1,8 @@
+-- +goose Up
+ALTER TABLE tasks ADD COLUMN deleted_at TIMESTAMPTZ;
+CREATE INDEX idx_tasks_board_id_deleted_at ON tasks(board_id, deleted_at);
+
+
+-- +goose Down
+DROP INDEX idx_tasks_board_id_deleted_at;
+ALTER TABLE tasks DROP COLUMN deleted_at;
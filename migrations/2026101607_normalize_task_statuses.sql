@@ -0,0 +1,19 @@
+-- +goose Up
+UPDATE tasks SET status = 'to_do' WHERE LOWER(TRIM(status)) IN ('', 'todo', 'to-do', 'to do');
+UPDATE tasks SET status = 'in_progress' WHERE LOWER(TRIM(status)) IN ('in-progress', 'inprogress', 'in progress');
+UPDATE tasks SET status = 'done' WHERE LOWER(TRIM(status)) = 'done';
+UPDATE task_status_history SET from_status = 'to_do' WHERE from_status = 'todo';
+UPDATE task_status_history SET from_status = 'in_progress' WHERE from_status = 'in-progress';
+UPDATE task_status_history SET to_status = 'to_do' WHERE to_status = 'todo';
+UPDATE task_status_history SET to_status = 'in_progress' WHERE to_status = 'in-progress';
+ALTER TABLE tasks ALTER COLUMN status SET DEFAULT 'to_do';
+
+
+-- +goose Down
+ALTER TABLE tasks ALTER COLUMN status SET DEFAULT 'todo';
+UPDATE task_status_history SET to_status = 'in-progress' WHERE to_status = 'in_progress';
+UPDATE task_status_history SET to_status = 'todo' WHERE to_status = 'to_do';
+UPDATE task_status_history SET from_status = 'in-progress' WHERE from_status = 'in_progress';
+UPDATE task_status_history SET from_status = 'todo' WHERE from_status = 'to_do';
+UPDATE tasks SET status = 'in-progress' WHERE status = 'in_progress';
+UPDATE tasks SET status = 'todo' WHERE status = 'to_do';
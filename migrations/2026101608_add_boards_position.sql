@@ -0,0 +1,8 @@
+-- +goose Up
+ALTER TABLE boards ADD COLUMN position INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX idx_boards_owner_id_position ON boards(owner_id, position);
+
+
+-- +goose Down
+DROP INDEX idx_boards_owner_id_position;
+ALTER TABLE boards DROP COLUMN position;
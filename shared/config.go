@@ -0,0 +1,35 @@
+package shared
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// minimum length of the secret the auth service signs tokens with
+const MinJWTSecretLength = 32
+
+/*
+Load the JWT signing secret.
+JWT_SECRET_FILE (e.g. a mounted Kubernetes secret) takes precedence over
+JWT_SECRET when both are set. The file contents are trimmed of surrounding
+whitespace. The secret must not be empty and must be at least minLength characters.
+*/
+func LoadJWTSecret(minLength int) (string, error) {
+	secret := os.Getenv("JWT_SECRET")
+	if path := os.Getenv("JWT_SECRET_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("cannot read JWT_SECRET_FILE: %w", err)
+		}
+		secret = strings.TrimSpace(string(data))
+	}
+
+	if secret == "" {
+		return "", fmt.Errorf("JWT_SECRET or JWT_SECRET_FILE must be set")
+	}
+	if len(secret) < minLength {
+		return "", fmt.Errorf("JWT secret must be at least %d characters", minLength)
+	}
+	return secret, nil
+}
@@ -0,0 +1,20 @@
+package shared
+
+import "testing"
+
+func TestLoadJWTSecret_MinLength(t *testing.T) {
+	t.Setenv("JWT_SECRET_FILE", "")
+	t.Setenv("JWT_SECRET", "short")
+
+	if _, err := LoadJWTSecret(MinJWTSecretLength); err == nil {
+		t.Fatalf("expected error for a secret shorter than %d characters", MinJWTSecretLength)
+	}
+	if secret, err := LoadJWTSecret(0); err != nil || secret != "short" {
+		t.Fatalf("without a minimum length: secret=%q err=%v", secret, err)
+	}
+
+	t.Setenv("JWT_SECRET", "")
+	if _, err := LoadJWTSecret(0); err == nil {
+		t.Fatalf("expected error for an empty secret")
+	}
+}
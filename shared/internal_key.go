@@ -0,0 +1,21 @@
+package shared
+
+import (
+	"crypto/subtle"
+	"net/http"
+)
+
+// header carrying the API key of trusted internal callers
+const InternalAPIKeyHeader = "X-Internal-API-Key"
+
+/*
+Report whether the request carries the configured internal API key.
+The key is compared in constant time. An empty key disables internal access.
+*/
+func IsInternalCaller(r *http.Request, key string) bool {
+	if key == "" {
+		return false
+	}
+	got := r.Header.Get(InternalAPIKeyHeader)
+	return subtle.ConstantTimeCompare([]byte(got), []byte(key)) == 1
+}
@@ -0,0 +1,26 @@
+package shared
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// ErrTrailingJSON is returned by DecodeJSON when the body holds more than one JSON value
+var ErrTrailingJSON = errors.New("unexpected data after JSON body")
+
+/*
+Decode a single JSON value from r into v.
+Unless allowTrailing is set, another value after it is rejected with ErrTrailingJSON,
+so a body like {"title":"x"}{"title":"y"} isn't accepted with the second object dropped.
+*/
+func DecodeJSON(r io.Reader, v any, allowTrailing bool) error {
+	dec := json.NewDecoder(r)
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if !allowTrailing && dec.More() {
+		return ErrTrailingJSON
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package shared
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDecodeJSON_TrailingData(t *testing.T) {
+	var v struct{ Title string }
+
+	if err := DecodeJSON(strings.NewReader(`{"title":"x"}`+"\n"), &v, false); err != nil || v.Title != "x" {
+		t.Fatalf("single value: err=%v title=%q", err, v.Title)
+	}
+
+	body := `{"title":"x"}{"title":"y"}`
+	if err := DecodeJSON(strings.NewReader(body), &v, false); !errors.Is(err, ErrTrailingJSON) {
+		t.Fatalf("want ErrTrailingJSON, got %v", err)
+	}
+	if err := DecodeJSON(strings.NewReader(body), &v, true); err != nil || v.Title != "x" {
+		t.Fatalf("allowTrailing: err=%v title=%q", err, v.Title)
+	}
+}
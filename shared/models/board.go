@@ -10,6 +10,27 @@ type Board struct {
 	OwnerID     uuid.UUID
 	Title       string
 	Description string
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
+	// client-supplied natural key, unique per owner, nil if unset
+	ExternalRef *string
+	// order on the owner's dashboard, 0 until the owner reorders their boards
+	Position  int
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// BoardRole is a user's role on a board. The owner is taken from
+// Board.OwnerID, other roles come from board membership.
+type BoardRole string
+
+const (
+	BoardRoleOwner  BoardRole = "owner"
+	BoardRoleEditor BoardRole = "editor"
+	BoardRoleViewer BoardRole = "viewer"
+)
+
+type BoardMember struct {
+	BoardID   uuid.UUID
+	UserID    uuid.UUID
+	Role      BoardRole
+	CreatedAt time.Time
 }
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// RefreshToken is a stored refresh token. Only a hash of the token is kept.
+type RefreshToken struct {
+	TokenHash string
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+	// set when the token is exchanged, nil while it is current
+	RotatedAt     *time.Time
+	SuccessorHash *string
+	GraceUsed     bool
+	CreatedAt     time.Time
+}
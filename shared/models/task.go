@@ -1,6 +1,7 @@
 package models
 
 import (
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -14,12 +15,56 @@ const (
 	TaskStatusDone       TaskStatus = "done"
 )
 
+// Canonical reports whether the status is one of the TaskStatus constants
+func (s TaskStatus) Canonical() bool {
+	switch s {
+	case TaskStatusToDo, TaskStatusInProgress, TaskStatusDone:
+		return true
+	}
+	return false
+}
+
+/*
+NormalizeTaskStatus maps user input and legacy stored values
+("todo", "in-progress", ...) to the canonical status.
+An empty status means TaskStatusToDo. ok is false for unknown values.
+*/
+func NormalizeTaskStatus(s string) (status TaskStatus, ok bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "todo", "to_do", "to-do", "to do":
+		return TaskStatusToDo, true
+	case "in_progress", "in-progress", "inprogress", "in progress":
+		return TaskStatusInProgress, true
+	case "done":
+		return TaskStatusDone, true
+	default:
+		return "", false
+	}
+}
+
 type Task struct {
 	ID          uuid.UUID
 	BoardID     uuid.UUID
 	Title       string
 	Description string
 	Status      TaskStatus
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
+	// reference to a ticket in an external system (Jira, GitHub), nil if unset
+	ExternalRef *string
+	// always in UTC, nil if the task has no due date
+	DueDate   *time.Time
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// set when the task is soft-deleted, only admins see deleted tasks
+	DeletedAt *time.Time `json:",omitempty"`
+}
+
+// TaskStatusChange is an audit record of a task's status transition.
+// ChangedBy is the user who made the change, not the board owner.
+type TaskStatusChange struct {
+	ID         uuid.UUID
+	TaskID     uuid.UUID
+	FromStatus TaskStatus
+	ToStatus   TaskStatus
+	ChangedBy  uuid.UUID
+	ChangedAt  time.Time
 }
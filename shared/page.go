@@ -0,0 +1,26 @@
+package shared
+
+/*
+Page is the envelope of every paginated list response.
+NextOffset is nil on the last page.
+*/
+type Page[T any] struct {
+	Items      []T  `json:"items"`
+	Total      int  `json:"total"`
+	Limit      int  `json:"limit"`
+	Offset     int  `json:"offset"`
+	NextOffset *int `json:"next_offset"`
+}
+
+// NewPage wraps one page of items out of total, fetched with limit and offset
+func NewPage[T any](items []T, total, limit, offset int) Page[T] {
+	if items == nil {
+		// encode an empty page as [], not null
+		items = []T{}
+	}
+	page := Page[T]{Items: items, Total: total, Limit: limit, Offset: offset}
+	if next := offset + len(items); len(items) > 0 && next < total {
+		page.NextOffset = &next
+	}
+	return page
+}
@@ -0,0 +1,53 @@
+package shared
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestNewPage_MidDataset(t *testing.T) {
+	// items 10..19 of 45
+	items := make([]int, 10)
+	for i := range items {
+		items[i] = 10 + i
+	}
+	page := NewPage(items, 45, 10, 10)
+
+	if page.Total != 45 || page.Limit != 10 || page.Offset != 10 || len(page.Items) != 10 {
+		t.Fatalf("unexpected page: %+v", page)
+	}
+	if page.NextOffset == nil || *page.NextOffset != 20 {
+		t.Fatalf("want next_offset 20, got %v", page.NextOffset)
+	}
+
+	data, err := json.Marshal(page)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	for _, name := range []string{"items", "total", "limit", "offset", "next_offset"} {
+		if _, ok := fields[name]; !ok {
+			t.Errorf("envelope is missing %q: %s", name, data)
+		}
+	}
+}
+
+func TestNewPage_LastAndEmpty(t *testing.T) {
+	last := NewPage([]string{"a", "b"}, 12, 10, 10)
+	if last.NextOffset != nil {
+		t.Fatalf("last page: want no next_offset, got %d", *last.NextOffset)
+	}
+
+	empty := NewPage[string](nil, 0, 10, 0)
+	data, err := json.Marshal(empty)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	want := `{"items":[],"total":0,"limit":10,"offset":0,"next_offset":null}`
+	if string(data) != want {
+		t.Fatalf("empty page = %s, want %s", data, want)
+	}
+}
@@ -0,0 +1,85 @@
+package shared
+
+import (
+	"bufio"
+	"log"
+	"net"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/google/uuid"
+)
+
+// header carrying the request ID, echoed on a recovered panic to match the log line
+const RequestIDHeader = "X-Request-ID"
+
+/*
+Recover turns a panic in next into a 500 JSON error instead of a dropped connection.
+The panic is logged with its stack and the request ID, taken from RequestIDHeader or generated.
+If the handler already wrote a response or hijacked the connection
+(e.g. a WebSocket upgrade), the panic is only logged, as nothing more can be sent.
+*/
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &recoverWriter{ResponseWriter: w}
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			// the server's own way to abort a response, let it through
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+
+			requestID := r.Header.Get(RequestIDHeader)
+			if requestID == "" {
+				requestID = uuid.NewString()
+			}
+			log.Printf("panic serving %s %s (request %s): %v\n%s", r.Method, r.URL.Path, requestID, err, debug.Stack())
+
+			if rw.hijacked || rw.wroteHeader {
+				return
+			}
+			w.Header().Set(RequestIDHeader, requestID)
+			SendError(w, "Internal server error", http.StatusInternalServerError)
+		}()
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// recoverWriter tracks whether a response can still be sent
+type recoverWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+	hijacked    bool
+}
+
+func (w *recoverWriter) WriteHeader(status int) {
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recoverWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush keeps streaming responses working through the wrapper
+func (w *recoverWriter) Flush() {
+	w.wroteHeader = true
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Hijack keeps WebSocket upgrades working through the wrapper
+func (w *recoverWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, buf, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil {
+		w.hijacked = true
+	}
+	return conn, buf, err
+}
+
+func (w *recoverWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -10,3 +10,10 @@ func SendError(w http.ResponseWriter, msg string, status int) {
 	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(map[string]string{"error": msg})
 }
+
+// SendValidationErrors reports every invalid field at once, keyed by field name
+func SendValidationErrors(w http.ResponseWriter, fields map[string]string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]any{"error": "Validation failed", "fields": fields})
+}
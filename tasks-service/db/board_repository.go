@@ -3,9 +3,11 @@ package db
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 
 	"github.com/chepyr/go-task-tracker/shared/models"
+	"github.com/google/uuid"
 )
 
 // defines methods for board db operations
@@ -14,6 +16,9 @@ type BoardRepositoryInterface interface {
 	GetByID(ctx context.Context, id string) (*models.Board, error)
 }
 
+// ErrBoardNotOwned is returned when a board doesn't exist or belongs to another user
+var ErrBoardNotOwned = errors.New("board not owned by user")
+
 type BoardRepository struct {
 	db *sql.DB
 }
@@ -23,8 +28,8 @@ func NewBoardRepository(db *sql.DB) *BoardRepository {
 }
 
 func (r *BoardRepository) Create(ctx context.Context, board *models.Board) error {
-	query := `INSERT INTO boards (id, owner_id, title, description, created_at, updated_at)
-	 VALUES ($1, $2, $3, $4, $5, $6)`
+	query := `INSERT INTO boards (id, owner_id, title, description, external_ref, created_at, updated_at)
+	 VALUES ($1, $2, $3, $4, $5, $6, $7)`
 
 	// check title
 	if board.Title == "" {
@@ -38,20 +43,22 @@ func (r *BoardRepository) Create(ctx context.Context, board *models.Board) error
 	}
 
 	_, err := r.db.ExecContext(
-		ctx, query, board.ID, board.OwnerID, board.Title, board.Description,
+		ctx, query, board.ID, board.OwnerID, board.Title, board.Description, board.ExternalRef,
 		board.CreatedAt, board.UpdatedAt)
 	return err
 }
 
 func (r *BoardRepository) GetByID(ctx context.Context, id string) (*models.Board, error) {
-	query := `SELECT id, owner_id, title, description, created_at, updated_at
+	query := `SELECT id, owner_id, title, description, external_ref, position, created_at, updated_at
 	 FROM boards WHERE id = $1`
-	board := &models.Board{}
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&board.ID, &board.OwnerID, &board.Title, &board.Description,
-		&board.CreatedAt, &board.UpdatedAt,
-	)
-	return board, err
+	return scanBoard(r.db.QueryRowContext(ctx, query, id))
+}
+
+// GetByExternalRef returns sql.ErrNoRows if the owner has no board with this external_ref
+func (r *BoardRepository) GetByExternalRef(ctx context.Context, ownerID, externalRef string) (*models.Board, error) {
+	query := `SELECT id, owner_id, title, description, external_ref, position, created_at, updated_at
+	 FROM boards WHERE owner_id = $1 AND external_ref = $2`
+	return scanBoard(r.db.QueryRowContext(ctx, query, ownerID, externalRef))
 }
 
 func (r *BoardRepository) Delete(ctx context.Context, id string) error {
@@ -71,25 +78,27 @@ func (r *BoardRepository) Delete(ctx context.Context, id string) error {
 	return err
 }
 
+// Update writes all editable fields in a single statement
 func (r *BoardRepository) Update(ctx context.Context, board *models.Board) error {
-	var exists bool
-	query := `SELECT EXISTS(SELECT 1 FROM boards WHERE id = $1)`
-	err := r.db.QueryRowContext(ctx, query, board.ID).Scan(&exists)
+	query := `UPDATE boards SET title = $1, description = $2, updated_at = $3 WHERE id = $4`
+	res, err := r.db.ExecContext(ctx, query, board.Title, board.Description, board.UpdatedAt, board.ID)
 	if err != nil {
 		return err
 	}
-	if !exists {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
 		return fmt.Errorf("board with id %s does not exist", board.ID)
 	}
-
-	query = `UPDATE boards SET title = $1, description = $2, updated_at = $3 WHERE id = $4`
-	_, err = r.db.ExecContext(ctx, query, board.Title, board.Description, board.UpdatedAt, board.ID)
-	return err
+	return nil
 }
 
+// ListByUserID lists the owner's boards by position; boards that were never reordered come first, newest first
 func (r *BoardRepository) ListByUserID(ctx context.Context, ownerID string) ([]*models.Board, error) {
-	query := `SELECT id, owner_id, title, description, created_at, updated_at
-	 FROM boards WHERE owner_id = $1 ORDER BY created_at DESC`
+	query := `SELECT id, owner_id, title, description, external_ref, position, created_at, updated_at
+	 FROM boards WHERE owner_id = $1 ORDER BY position, created_at DESC`
 	rows, err := r.db.QueryContext(ctx, query, ownerID)
 	if err != nil {
 		return nil, err
@@ -98,11 +107,8 @@ func (r *BoardRepository) ListByUserID(ctx context.Context, ownerID string) ([]*
 
 	var boards []*models.Board
 	for rows.Next() {
-		board := &models.Board{}
-		if err := rows.Scan(
-			&board.ID, &board.OwnerID, &board.Title, &board.Description,
-			&board.CreatedAt, &board.UpdatedAt,
-		); err != nil {
+		board, err := scanBoard(rows)
+		if err != nil {
 			return nil, err
 		}
 		boards = append(boards, board)
@@ -112,3 +118,180 @@ func (r *BoardRepository) ListByUserID(ctx context.Context, ownerID string) ([]*
 	}
 	return boards, nil
 }
+
+/*
+RolesByIDs returns the user's role on each existing board in ids, in one query:
+BoardRoleOwner, their member role, or "" if they have no access.
+Missing boards are left out.
+*/
+func (r *BoardRepository) RolesByIDs(ctx context.Context, userID string, ids []string) (map[uuid.UUID]models.BoardRole, error) {
+	roles := make(map[uuid.UUID]models.BoardRole, len(ids))
+	if len(ids) == 0 {
+		return roles, nil
+	}
+	placeholders, args := inPlaceholders(2, ids)
+	query := `SELECT b.id, b.owner_id, m.role FROM boards b
+	 LEFT JOIN board_members m ON m.board_id = b.id AND m.user_id = $1
+	 WHERE b.id IN (` + placeholders + `)`
+	rows, err := r.db.QueryContext(ctx, query, append([]any{userID}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, ownerID uuid.UUID
+		var role sql.NullString
+		if err := rows.Scan(&id, &ownerID, &role); err != nil {
+			return nil, err
+		}
+		if ownerID.String() == userID {
+			roles[id] = models.BoardRoleOwner
+		} else {
+			roles[id] = models.BoardRole(role.String)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+/*
+Set the positions of the owner's boards to the order of ids, in one transaction.
+Positions start at 1, so boards created afterwards (position 0) show up first.
+Boards not in ids keep their position.
+Returns ErrBoardNotOwned, and changes nothing, if any id is not a board of the owner.
+*/
+func (r *BoardRepository) Reorder(ctx context.Context, ownerID string, ids []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE boards SET position = $1 WHERE id = $2 AND owner_id = $3`
+	for i, id := range ids {
+		res, err := tx.ExecContext(ctx, query, i+1, id, ownerID)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return fmt.Errorf("%w: %s", ErrBoardNotOwned, id)
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *BoardRepository) AddMember(ctx context.Context, member *models.BoardMember) error {
+	switch member.Role {
+	case models.BoardRoleEditor, models.BoardRoleViewer:
+	default:
+		return fmt.Errorf("invalid board member role %q", member.Role)
+	}
+
+	query := `INSERT INTO board_members (board_id, user_id, role, created_at)
+	 VALUES ($1, $2, $3, $4)`
+	_, err := r.db.ExecContext(
+		ctx, query, member.BoardID, member.UserID, member.Role, member.CreatedAt)
+	return err
+}
+
+// GetMemberRole returns sql.ErrNoRows if the user is not a member of the board
+func (r *BoardRepository) GetMemberRole(ctx context.Context, boardID, userID string) (models.BoardRole, error) {
+	query := `SELECT role FROM board_members WHERE board_id = $1 AND user_id = $2`
+	var role models.BoardRole
+	err := r.db.QueryRowContext(ctx, query, boardID, userID).Scan(&role)
+	return role, err
+}
+
+/*
+Load the board and its members in one transaction,
+so the roster is consistent with the board's owner.
+Members are ordered by when they joined. Returns sql.ErrNoRows if there is no board.
+*/
+func (r *BoardRepository) GetWithMembers(ctx context.Context, id string) (*models.Board, []*models.BoardMember, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT id, owner_id, title, description, external_ref, position, created_at, updated_at
+	 FROM boards WHERE id = $1`
+	board, err := scanBoard(tx.QueryRowContext(ctx, query, id))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	query = `SELECT board_id, user_id, role, created_at FROM board_members
+	 WHERE board_id = $1 ORDER BY created_at`
+	rows, err := tx.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var members []*models.BoardMember
+	for rows.Next() {
+		member := &models.BoardMember{}
+		if err := rows.Scan(&member.BoardID, &member.UserID, &member.Role, &member.CreatedAt); err != nil {
+			return nil, nil, err
+		}
+		members = append(members, member)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	return board, members, tx.Commit()
+}
+
+/*
+Set board.OwnerID as the new owner of the board.
+The new owner's membership row is dropped, as the owner
+is taken from boards.owner_id.
+*/
+func (r *BoardRepository) TransferOwnership(ctx context.Context, board *models.Board) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE boards SET owner_id = $1, updated_at = $2 WHERE id = $3`
+	res, err := tx.ExecContext(ctx, query, board.OwnerID, board.UpdatedAt, board.ID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("board with id %s does not exist", board.ID)
+	}
+
+	query = `DELETE FROM board_members WHERE board_id = $1 AND user_id = $2`
+	if _, err := tx.ExecContext(ctx, query, board.ID, board.OwnerID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// scan the columns selected by the board queries, in order
+func scanBoard(row rowScanner) (*models.Board, error) {
+	board := &models.Board{}
+	var externalRef sql.NullString
+	err := row.Scan(
+		&board.ID, &board.OwnerID, &board.Title, &board.Description,
+		&externalRef, &board.Position, &board.CreatedAt, &board.UpdatedAt,
+	)
+	if externalRef.Valid {
+		board.ExternalRef = &externalRef.String
+	}
+	return board, err
+}
@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"database/sql"
 	"testing"
 	"time"
 
@@ -227,3 +228,123 @@ func TestBoardRepository_Create_InvalidData(t *testing.T) {
 		t.Fatal("Expected error when creating board with too long description, got nil")
 	}
 }
+
+func TestBoardRepository_AddMemberAndGetMemberRole(t *testing.T) {
+	dbx := setupTasksDB(t)
+	defer dbx.Close()
+	repo := NewBoardRepository(dbx)
+
+	board := insertBoard(t, dbx, uuid.New())
+	viewer := uuid.New()
+
+	member := &models.BoardMember{
+		BoardID:   board.ID,
+		UserID:    viewer,
+		Role:      models.BoardRoleViewer,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := repo.AddMember(context.Background(), member); err != nil {
+		t.Fatalf("AddMember: %v", err)
+	}
+
+	role, err := repo.GetMemberRole(context.Background(), board.ID.String(), viewer.String())
+	if err != nil {
+		t.Fatalf("GetMemberRole: %v", err)
+	}
+	if role != models.BoardRoleViewer {
+		t.Errorf("Expected role %q, got %q", models.BoardRoleViewer, role)
+	}
+
+	_, err = repo.GetMemberRole(context.Background(), board.ID.String(), uuid.New().String())
+	if err != sql.ErrNoRows {
+		t.Errorf("Expected sql.ErrNoRows for non-member, got %v", err)
+	}
+
+	// the owner is taken from boards.owner_id and can't be added as a member
+	member.UserID = uuid.New()
+	member.Role = models.BoardRoleOwner
+	if err := repo.AddMember(context.Background(), member); err == nil {
+		t.Error("Expected error when adding a member with owner role, got nil")
+	}
+}
+
+func TestBoardRepository_TransferOwnership(t *testing.T) {
+	dbx := setupTasksDB(t)
+	defer dbx.Close()
+	repo := NewBoardRepository(dbx)
+
+	board := insertBoard(t, dbx, uuid.New())
+	newOwner := uuid.New()
+
+	// the new owner was an editor before the transfer
+	err := repo.AddMember(context.Background(), &models.BoardMember{
+		BoardID:   board.ID,
+		UserID:    newOwner,
+		Role:      models.BoardRoleEditor,
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		t.Fatalf("AddMember: %v", err)
+	}
+
+	board.OwnerID = newOwner
+	board.UpdatedAt = time.Now().UTC()
+	if err := repo.TransferOwnership(context.Background(), &board); err != nil {
+		t.Fatalf("TransferOwnership: %v", err)
+	}
+
+	got, err := repo.GetByID(context.Background(), board.ID.String())
+	if err != nil {
+		t.Fatalf("GetByID after transfer: %v", err)
+	}
+	if got.OwnerID != newOwner {
+		t.Errorf("Expected owner %v, got %v", newOwner, got.OwnerID)
+	}
+	if _, err := repo.GetMemberRole(context.Background(), board.ID.String(), newOwner.String()); err != sql.ErrNoRows {
+		t.Errorf("Expected new owner's membership to be removed, got %v", err)
+	}
+
+	missing := models.Board{ID: uuid.New(), OwnerID: uuid.New()}
+	if err := repo.TransferOwnership(context.Background(), &missing); err == nil {
+		t.Error("Expected error when transferring non-existent board, got nil")
+	}
+}
+
+func TestBoardRepository_RolesByIDs(t *testing.T) {
+	dbx := setupTasksDB(t)
+	defer dbx.Close()
+	repo := NewBoardRepository(dbx)
+
+	user := uuid.New()
+	owned := insertBoard(t, dbx, user)
+	shared := insertBoard(t, dbx, uuid.New())
+	foreign := insertBoard(t, dbx, uuid.New())
+	err := repo.AddMember(context.Background(), &models.BoardMember{
+		BoardID:   shared.ID,
+		UserID:    user,
+		Role:      models.BoardRoleViewer,
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		t.Fatalf("AddMember: %v", err)
+	}
+
+	roles, err := repo.RolesByIDs(context.Background(), user.String(),
+		[]string{owned.ID.String(), shared.ID.String(), foreign.ID.String(), uuid.NewString()})
+	if err != nil {
+		t.Fatalf("RolesByIDs: %v", err)
+	}
+	want := map[uuid.UUID]models.BoardRole{
+		owned.ID:   models.BoardRoleOwner,
+		shared.ID:  models.BoardRoleViewer,
+		foreign.ID: "",
+	}
+	if len(roles) != len(want) {
+		t.Fatalf("Expected roles on the 3 existing boards, got %v", roles)
+	}
+	for id, role := range want {
+		if roles[id] != role {
+			t.Errorf("Board %s: expected role %q, got %q", id, role, roles[id])
+		}
+	}
+}
@@ -3,7 +3,11 @@ package db
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"log"
+	"strings"
+	"time"
 
 	"github.com/chepyr/go-task-tracker/shared/models"
 )
@@ -14,8 +18,20 @@ type TaskRepositoryInterface interface {
 	GetByID(ctx context.Context, id string) (*models.Task, error)
 }
 
+// status a lenient read gives a stored status that can't be normalized
+const UnknownStatusFallback = models.TaskStatusToDo
+
+// ErrNonCanonicalStatus is returned in strict mode for a stored status outside the canonical set
+var ErrNonCanonicalStatus = errors.New("non-canonical task status")
+
 type TaskRepository struct {
 	db *sql.DB
+
+	// StrictStatuses makes reads fail with ErrNonCanonicalStatus on a
+	// non-canonical stored status, for data-integrity audits.
+	// Otherwise legacy values like "todo" are coerced to the canonical status,
+	// and unknown values to UnknownStatusFallback.
+	StrictStatuses bool
 }
 
 func NewTaskRepository(db *sql.DB) *TaskRepository {
@@ -23,8 +39,8 @@ func NewTaskRepository(db *sql.DB) *TaskRepository {
 }
 
 func (r *TaskRepository) Create(ctx context.Context, task *models.Task) error {
-	query := `INSERT INTO tasks (id, board_id, title, description, status, created_at, updated_at)
-	 VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	query := `INSERT INTO tasks (id, board_id, title, description, status, external_ref, due_date, created_at, updated_at)
+	 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
 
 	// check if board_id exists in boards table
 	var exists bool
@@ -37,23 +53,23 @@ func (r *TaskRepository) Create(ctx context.Context, task *models.Task) error {
 	}
 
 	_, err = r.db.ExecContext(
-		ctx, query, task.ID, task.BoardID, task.Title, task.Description, task.Status, task.CreatedAt, task.UpdatedAt)
+		ctx, query, task.ID, task.BoardID, task.Title, task.Description, task.Status, task.ExternalRef,
+		task.DueDate, task.CreatedAt, task.UpdatedAt)
 	return err
 }
 
 func (r *TaskRepository) GetByID(ctx context.Context, id string) (*models.Task, error) {
-	query := `SELECT id, board_id, title, description, status, created_at, updated_at FROM tasks WHERE id = $1`
-	task := &models.Task{}
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&task.ID, &task.BoardID, &task.Title, &task.Description, &task.Status, &task.CreatedAt, &task.UpdatedAt,
-	)
-	return task, err
+	query := `SELECT id, board_id, title, description, status, external_ref, due_date, created_at, updated_at,
+	 deleted_at FROM tasks WHERE id = $1 AND deleted_at IS NULL`
+	return r.scanTask(r.db.QueryRowContext(ctx, query, id))
 }
 
+// Delete soft-deletes the task, it is hidden from all queries except admin listings
 func (r *TaskRepository) Delete(ctx context.Context, id string) error {
 	// check if task exists
 	var exists bool
-	err := r.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM tasks WHERE id = $1)", id).Scan(&exists)
+	err := r.db.QueryRowContext(
+		ctx, "SELECT EXISTS(SELECT 1 FROM tasks WHERE id = $1 AND deleted_at IS NULL)", id).Scan(&exists)
 	if err != nil {
 		return err
 	}
@@ -61,8 +77,8 @@ func (r *TaskRepository) Delete(ctx context.Context, id string) error {
 		return fmt.Errorf("task_id %s does not exist", id)
 	}
 
-	query := `DELETE FROM tasks WHERE id = $1`
-	_, err = r.db.ExecContext(ctx, query, id)
+	query := `UPDATE tasks SET deleted_at = $1 WHERE id = $2`
+	_, err = r.db.ExecContext(ctx, query, time.Now().UTC(), id)
 	return err
 }
 
@@ -81,7 +97,8 @@ func (r *TaskRepository) Update(ctx context.Context, task *models.Task) error {
 
 	// check if task exists
 	var exists bool
-	err = r.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM tasks WHERE id = $1)", task.ID).Scan(&exists)
+	err = r.db.QueryRowContext(
+		ctx, "SELECT EXISTS(SELECT 1 FROM tasks WHERE id = $1 AND deleted_at IS NULL)", task.ID).Scan(&exists)
 	if err != nil {
 		return err
 	}
@@ -89,15 +106,71 @@ func (r *TaskRepository) Update(ctx context.Context, task *models.Task) error {
 		return fmt.Errorf("task_id %s does not exist", task.ID)
 	}
 
-	query := `UPDATE tasks SET title = $1, description = $2, status = $3, updated_at = $4 WHERE id = $5`
-	_, err = r.db.ExecContext(ctx, query, task.Title, task.Description, task.Status, task.UpdatedAt, task.ID)
+	query := `UPDATE tasks SET title = $1, description = $2, status = $3, external_ref = $4, due_date = $5,
+	 updated_at = $6 WHERE id = $7`
+	_, err = r.db.ExecContext(
+		ctx, query, task.Title, task.Description, task.Status, task.ExternalRef, task.DueDate,
+		task.UpdatedAt, task.ID)
 	return err
 }
 
 func (r *TaskRepository) ListByBoardID(ctx context.Context, boardID string) ([]*models.Task, error) {
-	query := `SELECT id, board_id, title, description, status, created_at, updated_at
-	 FROM tasks WHERE board_id = $1 ORDER BY created_at DESC`
-	rows, err := r.db.QueryContext(ctx, query, boardID)
+	query := `SELECT id, board_id, title, description, status, external_ref, due_date, created_at, updated_at,
+	 deleted_at FROM tasks WHERE board_id = $1 AND deleted_at IS NULL ORDER BY created_at DESC`
+	return r.queryTasks(ctx, query, boardID)
+}
+
+func (r *TaskRepository) ListByExternalRef(ctx context.Context, boardID, externalRef string) ([]*models.Task, error) {
+	query := `SELECT id, board_id, title, description, status, external_ref, due_date, created_at, updated_at,
+	 deleted_at FROM tasks WHERE board_id = $1 AND external_ref = $2 AND deleted_at IS NULL
+	 ORDER BY created_at DESC`
+	return r.queryTasks(ctx, query, boardID, externalRef)
+}
+
+// ListByBoardIDs lists the tasks of several boards, callers bound the number of ids
+func (r *TaskRepository) ListByBoardIDs(ctx context.Context, boardIDs []string) ([]*models.Task, error) {
+	if len(boardIDs) == 0 {
+		return nil, nil
+	}
+	placeholders, args := inPlaceholders(1, boardIDs)
+	query := `SELECT id, board_id, title, description, status, external_ref, due_date, created_at, updated_at,
+	 deleted_at FROM tasks WHERE board_id IN (` + placeholders + `) AND deleted_at IS NULL
+	 ORDER BY created_at DESC`
+	return r.queryTasks(ctx, query, args...)
+}
+
+// ListByIDs returns the tasks with these ids that aren't deleted, callers bound the number of ids
+func (r *TaskRepository) ListByIDs(ctx context.Context, ids []string) ([]*models.Task, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	placeholders, args := inPlaceholders(1, ids)
+	query := `SELECT id, board_id, title, description, status, external_ref, due_date, created_at, updated_at,
+	 deleted_at FROM tasks WHERE id IN (` + placeholders + `) AND deleted_at IS NULL
+	 ORDER BY created_at DESC`
+	return r.queryTasks(ctx, query, args...)
+}
+
+// "$first, $first+1, ..." and the matching arguments for an IN (...) clause
+func inPlaceholders(first int, ids []string) (string, []any) {
+	placeholders := make([]string, len(ids))
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		placeholders[i] = fmt.Sprintf("$%d", first+i)
+		args[i] = id
+	}
+	return strings.Join(placeholders, ", "), args
+}
+
+// ListByBoardIDIncludingDeleted also returns soft-deleted tasks, for admin queries
+func (r *TaskRepository) ListByBoardIDIncludingDeleted(ctx context.Context, boardID string) ([]*models.Task, error) {
+	query := `SELECT id, board_id, title, description, status, external_ref, due_date, created_at, updated_at,
+	 deleted_at FROM tasks WHERE board_id = $1 ORDER BY created_at DESC`
+	return r.queryTasks(ctx, query, boardID)
+}
+
+func (r *TaskRepository) queryTasks(ctx context.Context, query string, args ...any) ([]*models.Task, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -105,10 +178,8 @@ func (r *TaskRepository) ListByBoardID(ctx context.Context, boardID string) ([]*
 
 	var tasks []*models.Task
 	for rows.Next() {
-		task := &models.Task{}
-		if err := rows.Scan(
-			&task.ID, &task.BoardID, &task.Title, &task.Description,
-			&task.Status, &task.CreatedAt, &task.UpdatedAt); err != nil {
+		task, err := r.scanTask(rows)
+		if err != nil {
 			return nil, err
 		}
 		tasks = append(tasks, task)
@@ -118,3 +189,115 @@ func (r *TaskRepository) ListByBoardID(ctx context.Context, boardID string) ([]*
 	}
 	return tasks, nil
 }
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scan the columns selected by the task queries, in order
+func (r *TaskRepository) scanTask(row rowScanner) (*models.Task, error) {
+	task := &models.Task{}
+	var externalRef sql.NullString
+	var dueDate, deletedAt sql.NullTime
+	err := row.Scan(
+		&task.ID, &task.BoardID, &task.Title, &task.Description,
+		&task.Status, &externalRef, &dueDate, &task.CreatedAt, &task.UpdatedAt, &deletedAt)
+	if externalRef.Valid {
+		task.ExternalRef = &externalRef.String
+	}
+	if dueDate.Valid {
+		due := dueDate.Time.UTC()
+		task.DueDate = &due
+	}
+	if deletedAt.Valid {
+		deleted := deletedAt.Time.UTC()
+		task.DeletedAt = &deleted
+	}
+	// the driver returns times in the session time zone, the API always uses UTC
+	task.CreatedAt = task.CreatedAt.UTC()
+	task.UpdatedAt = task.UpdatedAt.UTC()
+	if err != nil {
+		return task, err
+	}
+	return task, r.checkStatus(task)
+}
+
+// enforce or coerce the canonical status of a loaded task
+func (r *TaskRepository) checkStatus(task *models.Task) error {
+	if task.Status.Canonical() {
+		return nil
+	}
+	if r.StrictStatuses {
+		return fmt.Errorf("task %s has status %q: %w", task.ID, task.Status, ErrNonCanonicalStatus)
+	}
+	status, ok := models.NormalizeTaskStatus(string(task.Status))
+	if !ok {
+		log.Printf("Task %s has unknown status %q, reading it as %q", task.ID, task.Status, UnknownStatusFallback)
+		status = UnknownStatusFallback
+	}
+	task.Status = status
+	return nil
+}
+
+// UpdateWithStatusChange updates the task and records the status change in one transaction
+func (r *TaskRepository) UpdateWithStatusChange(
+	ctx context.Context, task *models.Task, change *models.TaskStatusChange,
+) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE tasks SET title = $1, description = $2, status = $3, external_ref = $4, due_date = $5,
+	 updated_at = $6 WHERE id = $7 AND deleted_at IS NULL`
+	res, err := tx.ExecContext(
+		ctx, query, task.Title, task.Description, task.Status, task.ExternalRef, task.DueDate,
+		task.UpdatedAt, task.ID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("task_id %s does not exist", task.ID)
+	}
+
+	query = `INSERT INTO task_status_history (id, task_id, from_status, to_status, changed_by, changed_at)
+	 VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err = tx.ExecContext(
+		ctx, query, change.ID, change.TaskID, change.FromStatus, change.ToStatus,
+		change.ChangedBy, change.ChangedAt)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *TaskRepository) ListStatusHistory(ctx context.Context, taskID string) ([]*models.TaskStatusChange, error) {
+	query := `SELECT id, task_id, from_status, to_status, changed_by, changed_at
+	 FROM task_status_history WHERE task_id = $1 ORDER BY changed_at`
+	rows, err := r.db.QueryContext(ctx, query, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []*models.TaskStatusChange
+	for rows.Next() {
+		change := &models.TaskStatusChange{}
+		if err := rows.Scan(
+			&change.ID, &change.TaskID, &change.FromStatus, &change.ToStatus,
+			&change.ChangedBy, &change.ChangedAt); err != nil {
+			return nil, err
+		}
+		history = append(history, change)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
@@ -3,6 +3,7 @@ package db
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"log"
 	"testing"
 	"time"
@@ -25,17 +26,38 @@ CREATE TABLE boards (
   owner_id TEXT NOT NULL,
   title TEXT NOT NULL,
   description TEXT,
+  external_ref TEXT,
+  position INTEGER NOT NULL DEFAULT 0,
   created_at TIMESTAMP NOT NULL,
   updated_at TIMESTAMP NOT NULL
 );
+CREATE UNIQUE INDEX idx_boards_owner_id_external_ref ON boards(owner_id, external_ref);
 CREATE TABLE tasks (
   id TEXT PRIMARY KEY,
   board_id TEXT NOT NULL,
   title TEXT NOT NULL,
   description TEXT,
   status TEXT NOT NULL,
+  external_ref TEXT,
+  due_date TIMESTAMP,
   created_at TIMESTAMP NOT NULL,
-  updated_at TIMESTAMP NOT NULL
+  updated_at TIMESTAMP NOT NULL,
+  deleted_at TIMESTAMP
+);
+CREATE TABLE task_status_history (
+  id TEXT PRIMARY KEY,
+  task_id TEXT NOT NULL,
+  from_status TEXT NOT NULL,
+  to_status TEXT NOT NULL,
+  changed_by TEXT NOT NULL,
+  changed_at TIMESTAMP NOT NULL
+);
+CREATE TABLE board_members (
+  board_id TEXT NOT NULL,
+  user_id TEXT NOT NULL,
+  role TEXT NOT NULL,
+  created_at TIMESTAMP NOT NULL,
+  PRIMARY KEY (board_id, user_id)
 );
 CREATE INDEX idx_boards_owner_id ON boards(owner_id);
 CREATE INDEX idx_tasks_board_id ON tasks(board_id);
@@ -92,7 +114,7 @@ func TestTaskRepository_Create_Get_Update_Delete_List(t *testing.T) {
 		BoardID:     b.ID,
 		Title:       "First task",
 		Description: "hello",
-		Status:      "todo",
+		Status:      models.TaskStatusToDo,
 		CreatedAt:   now,
 		UpdatedAt:   now,
 	}
@@ -105,13 +127,13 @@ func TestTaskRepository_Create_Get_Update_Delete_List(t *testing.T) {
 	if err != nil {
 		t.Fatalf("TaskRepository.GetByID: %v", err)
 	}
-	if got.ID != task.ID || got.Title != "First task" || got.Status != "todo" {
+	if got.ID != task.ID || got.Title != "First task" || got.Status != models.TaskStatusToDo {
 		t.Errorf("GetByID mismatch: %#v", got)
 	}
 
 	// Update
 	got.Title = "Updated"
-	got.Status = "in-progress"
+	got.Status = models.TaskStatusInProgress
 	got.UpdatedAt = time.Now().UTC()
 	if err := taskRepo.Update(context.Background(), got); err != nil {
 		t.Fatalf("TaskRepository.Update: %v", err)
@@ -120,7 +142,7 @@ func TestTaskRepository_Create_Get_Update_Delete_List(t *testing.T) {
 	if err != nil {
 		t.Fatalf("TaskRepository.GetByID after update: %v", err)
 	}
-	if after.Title != "Updated" || after.Status != "in-progress" {
+	if after.Title != "Updated" || after.Status != models.TaskStatusInProgress {
 		t.Errorf("Update not applied: %#v", after)
 	}
 
@@ -160,7 +182,7 @@ func TestTaskRepository_Create_InvalidBoard(t *testing.T) {
 		BoardID:     uuid.New(), // random board ID, does not exist
 		Title:       "Orphan task",
 		Description: "no board",
-		Status:      "todo",
+		Status:      models.TaskStatusToDo,
 		CreatedAt:   now,
 		UpdatedAt:   now,
 	}
@@ -221,7 +243,7 @@ func TestTaskRepository_Update_NonExistent(t *testing.T) {
 		BoardID:     uuid.New(),
 		Title:       "Non-existent",
 		Description: "nope",
-		Status:      "todo",
+		Status:      models.TaskStatusToDo,
 		CreatedAt:   now,
 		UpdatedAt:   now,
 	}
@@ -253,3 +275,156 @@ func TestTaskRepository_ListByBoardID_Empty(t *testing.T) {
 }
 
 // TODO: benchmark?
+
+func TestTaskRepository_ListByExternalRef(t *testing.T) {
+	dbx := setupTasksDB(t)
+	defer func() {
+		if err := dbx.Close(); err != nil {
+			log.Printf("close db: %v", err)
+		}
+	}()
+
+	taskRepo := NewTaskRepository(dbx)
+	b := insertBoard(t, dbx, uuid.New())
+
+	ref := "GH-7"
+	now := time.Now().UTC()
+	linked := &models.Task{
+		ID: uuid.New(), BoardID: b.ID, Title: "linked", Status: models.TaskStatusToDo,
+		ExternalRef: &ref, CreatedAt: now, UpdatedAt: now,
+	}
+	plain := &models.Task{
+		ID: uuid.New(), BoardID: b.ID, Title: "plain", Status: models.TaskStatusToDo,
+		CreatedAt: now, UpdatedAt: now,
+	}
+	for _, task := range []*models.Task{linked, plain} {
+		if err := taskRepo.Create(context.Background(), task); err != nil {
+			t.Fatalf("TaskRepository.Create: %v", err)
+		}
+	}
+
+	list, err := taskRepo.ListByExternalRef(context.Background(), b.ID.String(), ref)
+	if err != nil {
+		t.Fatalf("TaskRepository.ListByExternalRef: %v", err)
+	}
+	if len(list) != 1 || list[0].ID != linked.ID || list[0].ExternalRef == nil || *list[0].ExternalRef != ref {
+		t.Errorf("ListByExternalRef unexpected: %+v", list)
+	}
+
+	got, err := taskRepo.GetByID(context.Background(), plain.ID.String())
+	if err != nil {
+		t.Fatalf("TaskRepository.GetByID: %v", err)
+	}
+	if got.ExternalRef != nil {
+		t.Errorf("expected nil external_ref, got %q", *got.ExternalRef)
+	}
+}
+
+func TestTaskRepository_SoftDelete(t *testing.T) {
+	dbx := setupTasksDB(t)
+	defer func() {
+		if err := dbx.Close(); err != nil {
+			log.Printf("close db: %v", err)
+		}
+	}()
+
+	taskRepo := NewTaskRepository(dbx)
+	b := insertBoard(t, dbx, uuid.New())
+
+	now := time.Now().UTC()
+	task := &models.Task{
+		ID: uuid.New(), BoardID: b.ID, Title: "to delete", Status: models.TaskStatusToDo,
+		CreatedAt: now, UpdatedAt: now,
+	}
+	if err := taskRepo.Create(context.Background(), task); err != nil {
+		t.Fatalf("TaskRepository.Create: %v", err)
+	}
+	if err := taskRepo.Delete(context.Background(), task.ID.String()); err != nil {
+		t.Fatalf("TaskRepository.Delete: %v", err)
+	}
+
+	// hidden from regular queries, deleting twice fails
+	if list, err := taskRepo.ListByBoardID(context.Background(), b.ID.String()); err != nil || len(list) != 0 {
+		t.Errorf("ListByBoardID after delete: %+v, %v", list, err)
+	}
+	if err := taskRepo.Delete(context.Background(), task.ID.String()); err == nil {
+		t.Errorf("expected error deleting an already deleted task")
+	}
+	task.Title = "revived"
+	if err := taskRepo.Update(context.Background(), task); err == nil {
+		t.Errorf("expected error updating a deleted task")
+	}
+
+	list, err := taskRepo.ListByBoardIDIncludingDeleted(context.Background(), b.ID.String())
+	if err != nil {
+		t.Fatalf("TaskRepository.ListByBoardIDIncludingDeleted: %v", err)
+	}
+	if len(list) != 1 || list[0].ID != task.ID || list[0].DeletedAt == nil {
+		t.Errorf("ListByBoardIDIncludingDeleted unexpected: %+v", list)
+	}
+}
+
+// legacy statuses are coerced on a lenient read and rejected on a strict one
+func TestTaskRepository_StrictStatuses(t *testing.T) {
+	dbx := setupTasksDB(t)
+	defer func() {
+		if err := dbx.Close(); err != nil {
+			log.Printf("close db: %v", err)
+		}
+	}()
+
+	b := insertBoard(t, dbx, uuid.New())
+	legacyID := uuid.New()
+	now := time.Now().UTC()
+	// bypass the repository, like a row written before statuses were canonical
+	_, err := dbx.Exec(`INSERT INTO tasks (id, board_id, title, description, status, created_at, updated_at)
+	 VALUES ($1, $2, $3, $4, $5, $6, $7)`, legacyID, b.ID, "legacy", "", "in-progress", now, now)
+	if err != nil {
+		t.Fatalf("insert legacy task: %v", err)
+	}
+
+	lenient := NewTaskRepository(dbx)
+	got, err := lenient.GetByID(context.Background(), legacyID.String())
+	if err != nil {
+		t.Fatalf("lenient GetByID: %v", err)
+	}
+	if got.Status != models.TaskStatusInProgress {
+		t.Errorf("lenient read: want %q, got %q", models.TaskStatusInProgress, got.Status)
+	}
+
+	// a value that can't be normalized falls back to a canonical status
+	unknownID := uuid.New()
+	_, err = dbx.Exec(`INSERT INTO tasks (id, board_id, title, description, status, created_at, updated_at)
+	 VALUES ($1, $2, $3, $4, $5, $6, $7)`, unknownID, b.ID, "unknown", "", "blocked", now, now)
+	if err != nil {
+		t.Fatalf("insert unknown-status task: %v", err)
+	}
+	unknown, err := lenient.GetByID(context.Background(), unknownID.String())
+	if err != nil {
+		t.Fatalf("lenient GetByID: %v", err)
+	}
+	if unknown.Status != UnknownStatusFallback {
+		t.Errorf("lenient read of unknown status: want %q, got %q", UnknownStatusFallback, unknown.Status)
+	}
+	if _, err := dbx.Exec(`DELETE FROM tasks WHERE id = $1`, unknownID); err != nil {
+		t.Fatalf("delete unknown-status task: %v", err)
+	}
+
+	strict := NewTaskRepository(dbx)
+	strict.StrictStatuses = true
+	if _, err := strict.GetByID(context.Background(), legacyID.String()); !errors.Is(err, ErrNonCanonicalStatus) {
+		t.Errorf("strict GetByID: want ErrNonCanonicalStatus, got %v", err)
+	}
+	if _, err := strict.ListByBoardID(context.Background(), b.ID.String()); !errors.Is(err, ErrNonCanonicalStatus) {
+		t.Errorf("strict ListByBoardID: want ErrNonCanonicalStatus, got %v", err)
+	}
+
+	// once the row is canonical, strict reads succeed
+	got.UpdatedAt = time.Now().UTC()
+	if err := lenient.Update(context.Background(), got); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if _, err := strict.GetByID(context.Background(), legacyID.String()); err != nil {
+		t.Errorf("strict GetByID after normalization: %v", err)
+	}
+}
@@ -3,7 +3,6 @@ package handlers
 import (
 	"context"
 	"net/http"
-	"os"
 	"strings"
 
 	"github.com/chepyr/go-task-tracker/shared"
@@ -22,12 +21,16 @@ func (h *Handler) AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		tokenString := strings.TrimPrefix(ah, "Bearer ")
+		tokenString, ok := bearerToken(ah)
+		if !ok {
+			shared.SendError(w, "unsupported authorization scheme", http.StatusUnauthorized)
+			return
+		}
 
 		claims := jwt.MapClaims{}
 		parser := jwt.NewParser(jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
 		token, err := parser.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (any, error) {
-			return []byte(os.Getenv("JWT_SECRET")), nil
+			return []byte(h.JWTSecret), nil
 		})
 		if err != nil || !token.Valid {
 			shared.SendError(w, "Invalid token", http.StatusUnauthorized)
@@ -48,3 +51,12 @@ func (h *Handler) AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		next(w, r.WithContext(ctx))
 	}
 }
+
+// extract the token from a "Bearer <token>" header, the scheme is case-insensitive
+func bearerToken(header string) (string, bool) {
+	scheme, token, found := strings.Cut(strings.TrimSpace(header), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
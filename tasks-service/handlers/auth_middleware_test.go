@@ -3,7 +3,7 @@ package handlers
 import (
 	"net/http"
 	"net/http/httptest"
-	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -31,8 +31,7 @@ func TestAuthMiddleware_MissingAuthorizationHeader(t *testing.T) {
 
 // checks that returns 401 if token is invalid
 func TestAuthMiddleware_InvalidToken(t *testing.T) {
-	_ = os.Setenv("JWT_SECRET", "super_secret_for_tests")
-	h := &Handler{}
+	h := &Handler{JWTSecret: "super_secret_for_tests"}
 	next := func(w http.ResponseWriter, r *http.Request) { t.Fatalf("next must not be called on invalid token") }
 
 	req := httptest.NewRequest(http.MethodGet, "/any", nil)
@@ -49,7 +48,6 @@ func TestAuthMiddleware_InvalidToken(t *testing.T) {
 // checks that returns 401 if "exp" claim is missing
 func TestAuthMiddleware_MissingExp(t *testing.T) {
 	secret := "super_secret_for_tests"
-	_ = os.Setenv("JWT_SECRET", secret)
 
 	claims := jwt.MapClaims{
 		"sub": "11111111-1111-1111-1111-111111111111",
@@ -61,7 +59,7 @@ func TestAuthMiddleware_MissingExp(t *testing.T) {
 		t.Fatalf("sign: %v", err)
 	}
 
-	h := &Handler{}
+	h := &Handler{JWTSecret: secret}
 	next := func(w http.ResponseWriter, r *http.Request) { t.Fatalf("next must not be called when exp missing") }
 
 	req := httptest.NewRequest(http.MethodGet, "/any", nil)
@@ -78,7 +76,6 @@ func TestAuthMiddleware_MissingExp(t *testing.T) {
 // checks that returns 401 if "sub" claim is missing
 func TestAuthMiddleware_MissingSub(t *testing.T) {
 	secret := "super_secret_for_tests"
-	_ = os.Setenv("JWT_SECRET", secret)
 
 	claims := jwt.MapClaims{
 		// "sub" is missing
@@ -90,7 +87,7 @@ func TestAuthMiddleware_MissingSub(t *testing.T) {
 		t.Fatalf("sign: %v", err)
 	}
 
-	h := &Handler{}
+	h := &Handler{JWTSecret: secret}
 	next := func(w http.ResponseWriter, r *http.Request) { t.Fatalf("next must not be called when sub missing") }
 
 	req := httptest.NewRequest(http.MethodGet, "/any", nil)
@@ -107,7 +104,6 @@ func TestAuthMiddleware_MissingSub(t *testing.T) {
 // checks that returns 201 if token is valid, and user_id is put into context
 func TestAuthMiddleware_Valid_PassesUserIDInContext(t *testing.T) {
 	secret := "super_secret_for_tests"
-	_ = os.Setenv("JWT_SECRET", secret)
 
 	wantSub := "22222222-2222-2222-2222-222222222222"
 	claims := jwt.MapClaims{
@@ -120,7 +116,7 @@ func TestAuthMiddleware_Valid_PassesUserIDInContext(t *testing.T) {
 		t.Fatalf("sign: %v", err)
 	}
 
-	h := &Handler{}
+	h := &Handler{JWTSecret: secret}
 	nextCalled := false
 	next := func(w http.ResponseWriter, r *http.Request) {
 		nextCalled = true
@@ -144,3 +140,48 @@ func TestAuthMiddleware_Valid_PassesUserIDInContext(t *testing.T) {
 		t.Fatalf("want 200, got %d", rec.Code)
 	}
 }
+
+// checks that only the Bearer scheme is accepted, case-insensitively
+func TestAuthMiddleware_AuthorizationScheme(t *testing.T) {
+	secret := "super_secret_for_tests"
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "33333333-3333-3333-3333-333333333333",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	signed, err := token.SignedString([]byte(secret))
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		header     string
+		wantStatus int
+		wantBody   string
+	}{
+		{"basic scheme", "Basic dXNlcjpwYXNz", http.StatusUnauthorized, "unsupported authorization scheme"},
+		{"bare token", signed, http.StatusUnauthorized, "unsupported authorization scheme"},
+		{"bearer", "Bearer " + signed, http.StatusOK, ""},
+		{"lowercase bearer", "bearer " + signed, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{JWTSecret: secret}
+			next := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+
+			req := httptest.NewRequest(http.MethodGet, "/any", nil)
+			req.Header.Set("Authorization", tt.header)
+			rec := httptest.NewRecorder()
+
+			h.AuthMiddleware(next)(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("want %d, got %d body=%s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tt.wantBody != "" && !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Fatalf("body %q does not contain %q", rec.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
@@ -3,19 +3,23 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/chepyr/go-task-tracker/shared"
 	"github.com/chepyr/go-task-tracker/shared/models"
+	"github.com/chepyr/go-task-tracker/tasks-service/db"
 	"github.com/google/uuid"
 )
 
 /*
 handles routes:
 GET /boards - list boards
-POST /boards - create board
+POST /boards - create board, or return the existing one with the same external_ref
 */
 func (h *Handler) HandleBoards(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
@@ -28,8 +32,23 @@ func (h *Handler) HandleBoards(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+/*
+handles routes:
+GET/PUT/DELETE /boards/{id}
+GET /boards/{id}?embed=members - the board with its member list
+POST /boards/{id}/transfer - hand the board over to another user
+PATCH /boards/order - reorder the user's boards
+*/
 func (h *Handler) HandleBoardByID(w http.ResponseWriter, r *http.Request) {
-	boardID := strings.TrimPrefix(r.URL.Path, "/boards/")
+	boardID, subresource, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/boards/"), "/")
+	if boardID == "order" && subresource == "" {
+		if r.Method != http.MethodPatch {
+			shared.SendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.ReorderBoards(w, r)
+		return
+	}
 	if boardID == "" {
 		shared.SendError(w, "Board ID is required", http.StatusBadRequest)
 		return
@@ -38,6 +57,21 @@ func (h *Handler) HandleBoardByID(w http.ResponseWriter, r *http.Request) {
 		shared.SendError(w, "Invalid board ID", http.StatusBadRequest)
 		return
 	}
+
+	switch subresource {
+	case "":
+	case "transfer":
+		if r.Method != http.MethodPost {
+			shared.SendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.TransferBoard(w, r, boardID)
+		return
+	default:
+		shared.SendError(w, "Not found", http.StatusNotFound)
+		return
+	}
+
 	switch r.Method {
 	case http.MethodGet:
 		h.GetBoard(w, r, boardID)
@@ -74,6 +108,7 @@ func (h *Handler) DeleteBoard(w http.ResponseWriter, r *http.Request, boardID st
 		shared.SendError(w, "Failed to delete board", http.StatusInternalServerError)
 		return
 	}
+	h.OwnerCache.Invalidate(board.ID)
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -104,34 +139,173 @@ func (h *Handler) UpdateBoard(w http.ResponseWriter, r *http.Request, boardID st
 
 	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
 	var input struct{ Title, Description *string }
-	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+	if err := shared.DecodeJSON(r.Body, &input, h.AllowTrailingJSON); err != nil {
 		shared.SendError(w, "Invalid JSON body", 400)
 		return
 	}
+	// validate every provided field, the board is only updated if all are valid
 	updated := *board
+	fieldErrors := make(map[string]string)
 	if input.Title != nil {
 		updatedTitle := strings.TrimSpace(*input.Title)
 		if updatedTitle == "" || len(updatedTitle) > 100 {
-			shared.SendError(w, "Title is required and must be <= 100 characters", http.StatusBadRequest)
-			return
+			fieldErrors["title"] = "Title is required and must be <= 100 characters"
 		}
 		updated.Title = updatedTitle
 	}
 	if input.Description != nil {
 		if len(*input.Description) > 500 {
-			shared.SendError(w, "Description must be <= 500 characters", http.StatusBadRequest)
-			return
+			fieldErrors["description"] = "Description must be <= 500 characters"
 		}
 		updated.Description = *input.Description
 	}
+	if len(fieldErrors) > 0 {
+		shared.SendValidationErrors(w, fieldErrors)
+		return
+	}
 	updated.UpdatedAt = time.Now().UTC()
 	if err := h.BoardRepo.Update(ctx, &updated); err != nil {
 		shared.SendError(w, "Failed to update board", 500)
 		return
 	}
+	h.OwnerCache.Invalidate(updated.ID)
 	sendBoardsJSON(w, []*models.Board{&updated})
 }
 
+func (h *Handler) TransferBoard(w http.ResponseWriter, r *http.Request, boardID string) {
+	userId, _ := r.Context().Value("user_id").(string)
+	if userId == "" {
+		shared.SendError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	board, err := h.BoardRepo.GetByID(ctx, boardID)
+	if err != nil || board == nil {
+		shared.SendError(w, "Board not found", http.StatusNotFound)
+		return
+	}
+	if board.OwnerID.String() != userId {
+		shared.SendError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	if !isJSONContentType(r) {
+		shared.SendError(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	var input struct {
+		OwnerID string `json:"owner_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		shared.SendError(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	newOwnerID, err := uuid.Parse(input.OwnerID)
+	if err != nil {
+		shared.SendError(w, "owner_id must be a valid uuid", http.StatusBadRequest)
+		return
+	}
+	if newOwnerID == board.OwnerID {
+		shared.SendError(w, "Board already belongs to this user", http.StatusBadRequest)
+		return
+	}
+	if h.Users == nil {
+		log.Printf("Cannot transfer board %s: no user directory configured", board.ID)
+		shared.SendError(w, "Cannot verify new owner", http.StatusInternalServerError)
+		return
+	}
+	exists, err := h.Users.UserExists(ctx, newOwnerID)
+	if err != nil {
+		log.Printf("Error looking up user %s: %v", newOwnerID, err)
+		shared.SendError(w, "Cannot verify new owner", http.StatusBadGateway)
+		return
+	}
+	if !exists {
+		shared.SendError(w, "owner_id does not belong to a known user", http.StatusBadRequest)
+		return
+	}
+
+	board.OwnerID = newOwnerID
+	board.UpdatedAt = time.Now().UTC()
+	if err := h.BoardRepo.TransferOwnership(ctx, board); err != nil {
+		shared.SendError(w, "Failed to transfer board", http.StatusInternalServerError)
+		return
+	}
+	h.OwnerCache.Invalidate(board.ID)
+	sendBoardsJSON(w, []*models.Board{board})
+}
+
+// takes {"board_ids": [...]}, the user's boards in the new order, and returns the reordered list
+func (h *Handler) ReorderBoards(w http.ResponseWriter, r *http.Request) {
+	userID, _ := r.Context().Value("user_id").(string)
+	if userID == "" {
+		shared.SendError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if !isJSONContentType(r) {
+		shared.SendError(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	var input struct {
+		BoardIDs []string `json:"board_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		shared.SendError(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if len(input.BoardIDs) == 0 {
+		shared.SendError(w, "board_ids is required", http.StatusBadRequest)
+		return
+	}
+	if len(input.BoardIDs) > h.maxBatchIDs() {
+		shared.SendError(w, fmt.Sprintf("too many ids (max %d)", h.maxBatchIDs()), http.StatusBadRequest)
+		return
+	}
+	ids := make([]string, 0, len(input.BoardIDs))
+	seen := make(map[uuid.UUID]bool, len(input.BoardIDs))
+	for _, raw := range input.BoardIDs {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			shared.SendError(w, fmt.Sprintf("invalid id %q", raw), http.StatusBadRequest)
+			return
+		}
+		// a board can only have one position
+		if seen[id] {
+			shared.SendError(w, fmt.Sprintf("duplicate id %q", raw), http.StatusBadRequest)
+			return
+		}
+		seen[id] = true
+		ids = append(ids, id.String())
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := h.BoardRepo.Reorder(ctx, userID, ids); err != nil {
+		if errors.Is(err, db.ErrBoardNotOwned) {
+			shared.SendError(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		shared.SendError(w, "Failed to reorder boards", http.StatusInternalServerError)
+		return
+	}
+
+	boards, err := h.BoardRepo.ListByUserID(ctx, userID)
+	if err != nil {
+		shared.SendError(w, "Failed to fetch boards", http.StatusInternalServerError)
+		return
+	}
+	sendBoardsJSON(w, boards)
+}
+
 func (h *Handler) GetBoard(w http.ResponseWriter, r *http.Request, boardID string) {
 	userId, _ := r.Context().Value("user_id").(string)
 	if userId == "" {
@@ -139,6 +313,16 @@ func (h *Handler) GetBoard(w http.ResponseWriter, r *http.Request, boardID strin
 		return
 	}
 
+	switch embed := r.URL.Query().Get("embed"); embed {
+	case "":
+	case "members":
+		h.getBoardWithMembers(w, r, boardID, userId)
+		return
+	default:
+		shared.SendError(w, "Unsupported embed: "+embed, http.StatusBadRequest)
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
@@ -154,6 +338,43 @@ func (h *Handler) GetBoard(w http.ResponseWriter, r *http.Request, boardID strin
 	sendBoardsJSON(w, []*models.Board{board})
 }
 
+type boardMemberJSON struct {
+	UserID uuid.UUID        `json:"user_id"`
+	Role   models.BoardRole `json:"role"`
+}
+
+/*
+GET /boards/{id}?embed=members - the board with its roster, owner first.
+Readable by the owner and every member, including viewers.
+*/
+func (h *Handler) getBoardWithMembers(w http.ResponseWriter, r *http.Request, boardID, userID string) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	board, members, err := h.BoardRepo.GetWithMembers(ctx, boardID)
+	if err != nil {
+		shared.SendError(w, "Board not found", http.StatusNotFound)
+		return
+	}
+
+	roster := []boardMemberJSON{{UserID: board.OwnerID, Role: models.BoardRoleOwner}}
+	allowed := board.OwnerID.String() == userID
+	for _, member := range members {
+		roster = append(roster, boardMemberJSON{UserID: member.UserID, Role: member.Role})
+		allowed = allowed || member.UserID.String() == userID
+	}
+	if !allowed {
+		shared.SendError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode([]any{struct {
+		*models.Board
+		Members []boardMemberJSON `json:"members"`
+	}{board, roster}})
+}
+
 func (h *Handler) listBoards(w http.ResponseWriter, r *http.Request) {
 	userID, _ := r.Context().Value("user_id").(string)
 	if userID == "" {
@@ -188,8 +409,9 @@ func (h *Handler) createBoard(w http.ResponseWriter, r *http.Request) {
 	var newBoard struct {
 		Title       string `json:"title"`
 		Description string `json:"description"`
+		ExternalRef string `json:"external_ref"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&newBoard); err != nil {
+	if err := shared.DecodeJSON(r.Body, &newBoard, h.AllowTrailingJSON); err != nil {
 		shared.SendError(w, "Invalid JSON body", http.StatusBadRequest)
 		return
 	}
@@ -202,6 +424,22 @@ func (h *Handler) createBoard(w http.ResponseWriter, r *http.Request) {
 		shared.SendError(w, "Description must be <= 500 characters", http.StatusBadRequest)
 		return
 	}
+	externalRef, ok := parseExternalRef(newBoard.ExternalRef)
+	if !ok {
+		shared.SendError(w, "external_ref too long (max 100 chars)", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	// conditional create: a board with the same external_ref is returned as is
+	if externalRef != nil {
+		if existing, err := h.BoardRepo.GetByExternalRef(ctx, userID, *externalRef); err == nil {
+			sendExistingBoard(w, existing)
+			return
+		}
+	}
 
 	now := time.Now().UTC()
 	board := &models.Board{
@@ -209,14 +447,19 @@ func (h *Handler) createBoard(w http.ResponseWriter, r *http.Request) {
 		OwnerID:     uuid.MustParse(userID),
 		Title:       newBoard.Title,
 		Description: newBoard.Description,
+		ExternalRef: externalRef,
 		CreatedAt:   now,
 		UpdatedAt:   now,
 	}
 
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
-	defer cancel()
-
 	if err := h.BoardRepo.Create(ctx, board); err != nil {
+		// a concurrent request may have created it after the lookup
+		if externalRef != nil {
+			if existing, err := h.BoardRepo.GetByExternalRef(ctx, userID, *externalRef); err == nil {
+				sendExistingBoard(w, existing)
+				return
+			}
+		}
 		shared.SendError(w, "Failed to create board", http.StatusInternalServerError)
 		return
 	}
@@ -229,6 +472,11 @@ func isJSONContentType(r *http.Request) bool {
 	return strings.HasPrefix(strings.ToLower(ct), "application/json")
 }
 
+func sendExistingBoard(w http.ResponseWriter, board *models.Board) {
+	w.Header().Set("Location", "/boards/"+board.ID.String())
+	sendBoardsJSON(w, []*models.Board{board})
+}
+
 func sendBoardsJSON(w http.ResponseWriter, boards []*models.Board) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(boards)
@@ -9,6 +9,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/chepyr/go-task-tracker/shared/models"
 	tdb "github.com/chepyr/go-task-tracker/tasks-service/db"
@@ -28,9 +29,12 @@ CREATE TABLE boards (
   owner_id TEXT NOT NULL,
   title TEXT NOT NULL,
   description TEXT,
+  external_ref TEXT,
+  position INTEGER NOT NULL DEFAULT 0,
   created_at TIMESTAMP NOT NULL,
   updated_at TIMESTAMP NOT NULL
-);`
+);
+CREATE UNIQUE INDEX idx_boards_owner_id_external_ref ON boards(owner_id, external_ref);`
 	if _, err := dbx.Exec(ddl); err != nil {
 		t.Fatalf("create schema: %v", err)
 	}
@@ -326,6 +330,44 @@ func TestUpdateBoard_ValidationAndSuccess(t *testing.T) {
 	}
 }
 
+// every invalid field is reported at once and nothing is written
+func TestUpdateBoard_AggregatesValidationErrors(t *testing.T) {
+	h, dbx := handlerWithBoardsRepo(t)
+	defer dbx.Close()
+
+	owner := uuid.New()
+	boardID := createBoard(t, h, owner, "Old")
+
+	body := `{"title":"` + strings.Repeat("t", 101) + `","description":"` + strings.Repeat("d", 501) + `"}`
+	req := httptest.NewRequest(http.MethodPut, "/boards/"+boardID, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	req = ctxWithUser(owner.String(), req)
+	rec := httptest.NewRecorder()
+	h.HandleBoardByID(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("want 400, got %d body=%s", rec.Code, rec.Body.String())
+	}
+
+	var resp struct {
+		Error  string            `json:"error"`
+		Fields map[string]string `json:"fields"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Error == "" || resp.Fields["title"] == "" || resp.Fields["description"] == "" {
+		t.Fatalf("want errors for title and description, got %+v", resp)
+	}
+
+	board, err := h.BoardRepo.GetByID(context.Background(), boardID)
+	if err != nil {
+		t.Fatalf("get board: %v", err)
+	}
+	if board.Title != "Old" || board.Description != "d" {
+		t.Fatalf("board must not change on invalid input: %+v", board)
+	}
+}
+
 // checks
 func TestBoardTest_listBoards(t *testing.T) {
 	h, dbx := handlerWithBoardsRepo(t)
@@ -376,3 +418,189 @@ func TestBoardTest_listBoards(t *testing.T) {
 		t.Fatalf("want 0 boards for other, got %d", len(boardsOther))
 	}
 }
+
+// repeating a create with the same external_ref returns the existing board
+func TestCreateBoard_ExternalRefIsIdempotent(t *testing.T) {
+	h, dbx := handlerWithBoardsRepo(t)
+	defer dbx.Close()
+
+	userID := uuid.New().String()
+	post := func(userID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/boards",
+			bytes.NewBufferString(`{"title":"Sprint","external_ref":"sprint-12"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req = ctxWithUser(userID, req)
+		rec := httptest.NewRecorder()
+		h.HandleBoards(rec, req)
+		return rec
+	}
+
+	// 1) first create
+	rec1 := post(userID)
+	if rec1.Code != http.StatusCreated {
+		t.Fatalf("first create: want 201, got %d body=%s", rec1.Code, rec1.Body.String())
+	}
+	loc := rec1.Header().Get("Location")
+
+	// 2) repeat create returns the same board
+	rec2 := post(userID)
+	if rec2.Code != http.StatusOK {
+		t.Fatalf("repeat create: want 200, got %d body=%s", rec2.Code, rec2.Body.String())
+	}
+	if got := rec2.Header().Get("Location"); got != loc {
+		t.Fatalf("repeat create Location = %q, want %q", got, loc)
+	}
+	var resp []*struct {
+		ID          string `json:"id"`
+		ExternalRef *string
+	}
+	if err := json.Unmarshal(rec2.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp) != 1 || "/boards/"+resp[0].ID != loc || resp[0].ExternalRef == nil || *resp[0].ExternalRef != "sprint-12" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	boards, err := h.BoardRepo.ListByUserID(context.Background(), userID)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(boards) != 1 {
+		t.Fatalf("want 1 board after repeat create, got %d", len(boards))
+	}
+
+	// 3) the key is scoped per owner
+	if rec := post(uuid.New().String()); rec.Code != http.StatusCreated {
+		t.Fatalf("other user create: want 201, got %d", rec.Code)
+	}
+}
+
+// the board and its roster come back together, readable by a viewer member
+func TestGetBoard_EmbedMembers(t *testing.T) {
+	h, mux, dbx, secret := setupHTTP(t)
+	defer dbx.Close()
+
+	owner := uuid.New()
+	viewer := uuid.New()
+	editor := uuid.New()
+	now := time.Now().UTC()
+	board := &models.Board{ID: uuid.New(), OwnerID: owner, Title: "Team", CreatedAt: now, UpdatedAt: now}
+	if err := h.BoardRepo.Create(context.Background(), board); err != nil {
+		t.Fatalf("create board: %v", err)
+	}
+	for i, member := range []*models.BoardMember{
+		{BoardID: board.ID, UserID: editor, Role: models.BoardRoleEditor},
+		{BoardID: board.ID, UserID: viewer, Role: models.BoardRoleViewer},
+	} {
+		member.CreatedAt = now.Add(time.Duration(i) * time.Second)
+		if err := h.BoardRepo.AddMember(context.Background(), member); err != nil {
+			t.Fatalf("add member: %v", err)
+		}
+	}
+
+	get := func(userID uuid.UUID, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/boards/"+board.ID.String()+query, nil)
+		req.Header.Set("Authorization", bearerForUser(t, secret, userID.String()))
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get(viewer, "?embed=members")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("viewer: want 200, got %d body=%s", rec.Code, rec.Body.String())
+	}
+	var resp []struct {
+		ID      uuid.UUID `json:"id"`
+		Title   string    `json:"title"`
+		Members []struct {
+			UserID uuid.UUID        `json:"user_id"`
+			Role   models.BoardRole `json:"role"`
+		} `json:"members"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp) != 1 || resp[0].ID != board.ID || resp[0].Title != "Team" {
+		t.Fatalf("unexpected board: %s", rec.Body.String())
+	}
+	members := resp[0].Members
+	if len(members) != 3 ||
+		members[0].UserID != owner || members[0].Role != models.BoardRoleOwner ||
+		members[1].UserID != editor || members[1].Role != models.BoardRoleEditor ||
+		members[2].UserID != viewer || members[2].Role != models.BoardRoleViewer {
+		t.Fatalf("unexpected members: %+v", members)
+	}
+
+	if rec := get(owner, "?embed=members"); rec.Code != http.StatusOK {
+		t.Fatalf("owner: want 200, got %d", rec.Code)
+	}
+	if rec := get(uuid.New(), "?embed=members"); rec.Code != http.StatusForbidden {
+		t.Fatalf("stranger: want 403, got %d", rec.Code)
+	}
+	if rec := get(owner, "?embed=tasks"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("unsupported embed: want 400, got %d", rec.Code)
+	}
+}
+
+// checks that PATCH /boards/order changes the listed order, and rejects boards of other users
+func TestReorderBoards(t *testing.T) {
+	h, dbx := handlerWithBoardsRepo(t)
+	defer dbx.Close()
+
+	owner := uuid.New()
+	other := uuid.New()
+	first := createBoard(t, h, owner, "first")
+	second := createBoard(t, h, owner, "second")
+	third := createBoard(t, h, owner, "third")
+	foreign := createBoard(t, h, other, "foreign")
+
+	reorder := func(ids ...string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string][]string{"board_ids": ids})
+		req := ctxWithUser(owner.String(), httptest.NewRequest(http.MethodPatch, "/boards/order", bytes.NewReader(body)))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		h.HandleBoardByID(rec, req)
+		return rec
+	}
+	listed := func() []string {
+		req := ctxWithUser(owner.String(), httptest.NewRequest(http.MethodGet, "/boards", nil))
+		rec := httptest.NewRecorder()
+		h.HandleBoards(rec, req)
+		var boards []models.Board
+		if err := json.Unmarshal(rec.Body.Bytes(), &boards); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		ids := make([]string, len(boards))
+		for i, b := range boards {
+			ids[i] = b.ID.String()
+		}
+		return ids
+	}
+
+	want := []string{third, first, second}
+	if rec := reorder(want...); rec.Code != http.StatusOK {
+		t.Fatalf("reorder: want 200, got %d body=%s", rec.Code, rec.Body.String())
+	}
+	if got := listed(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("order after reorder = %v, want %v", got, want)
+	}
+
+	// nothing is reordered if one of the boards isn't the user's
+	if rec := reorder(first, second, foreign); rec.Code != http.StatusForbidden {
+		t.Fatalf("foreign board: want 403, got %d body=%s", rec.Code, rec.Body.String())
+	}
+	if got := listed(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("order changed by a rejected reorder: %v, want %v", got, want)
+	}
+
+	if rec := reorder(first, first); rec.Code != http.StatusBadRequest {
+		t.Fatalf("duplicate ids: want 400, got %d", rec.Code)
+	}
+	req := ctxWithUser(owner.String(), httptest.NewRequest(http.MethodPost, "/boards/order", nil))
+	rec := httptest.NewRecorder()
+	h.HandleBoardByID(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("POST /boards/order: want 405, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/chepyr/go-task-tracker/shared"
+)
+
+/*
+Reject GET and DELETE requests that carry a body when StrictBodies is set.
+The handlers ignore such bodies, so they usually point to a client bug.
+In the default lenient mode requests pass through unchanged.
+*/
+func (h *Handler) NoBodyMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.StrictBodies && (r.Method == http.MethodGet || r.Method == http.MethodDelete) && hasBody(r) {
+			shared.SendError(w, r.Method+" requests must not have a body", http.StatusBadRequest)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func hasBody(r *http.Request) bool {
+	if r.Body == nil || r.Body == http.NoBody {
+		return false
+	}
+	if r.ContentLength > 0 {
+		return true
+	}
+	if r.ContentLength == 0 {
+		return false
+	}
+	// unknown length (e.g. chunked encoding), peek one byte
+	n, _ := r.Body.Read(make([]byte, 1))
+	return n > 0
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// checks that a GET with a body is rejected in strict mode and passes through otherwise
+func TestNoBodyMiddleware_GetWithBody(t *testing.T) {
+	tests := []struct {
+		name       string
+		strict     bool
+		wantStatus int
+		wantNext   bool
+	}{
+		{name: "strict rejects", strict: true, wantStatus: http.StatusBadRequest, wantNext: false},
+		{name: "lenient allows", strict: false, wantStatus: http.StatusOK, wantNext: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{StrictBodies: tt.strict}
+			nextCalled := false
+			next := func(w http.ResponseWriter, r *http.Request) {
+				nextCalled = true
+				w.WriteHeader(http.StatusOK)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/boards", bytes.NewBufferString(`{"title":"x"}`))
+			rec := httptest.NewRecorder()
+
+			h.NoBodyMiddleware(next)(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("want %d, got %d body=%s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if nextCalled != tt.wantNext {
+				t.Fatalf("next called = %v, want %v", nextCalled, tt.wantNext)
+			}
+		})
+	}
+}
+
+// checks that strict mode lets through GET without a body and POST with a body
+func TestNoBodyMiddleware_StrictAllowsValidRequests(t *testing.T) {
+	h := &Handler{StrictBodies: true}
+	next := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+
+	reqGet := httptest.NewRequest(http.MethodGet, "/boards", nil)
+	recGet := httptest.NewRecorder()
+	h.NoBodyMiddleware(next)(recGet, reqGet)
+	if recGet.Code != http.StatusOK {
+		t.Fatalf("GET without body: want 200, got %d", recGet.Code)
+	}
+
+	reqPost := httptest.NewRequest(http.MethodPost, "/boards", bytes.NewBufferString(`{"title":"x"}`))
+	recPost := httptest.NewRecorder()
+	h.NoBodyMiddleware(next)(recPost, reqPost)
+	if recPost.Code != http.StatusOK {
+		t.Fatalf("POST with body: want 200, got %d", recPost.Code)
+	}
+}
@@ -1,8 +1,6 @@
 package handlers
 
 import (
-	"encoding/json"
-	"fmt"
 	"log"
 	"net"
 	"net/http"
@@ -12,10 +10,7 @@ import (
 	"time"
 
 	"github.com/chepyr/go-task-tracker/shared"
-	"github.com/chepyr/go-task-tracker/shared/models"
 	"github.com/chepyr/go-task-tracker/tasks-service/db"
-	"github.com/google/uuid"
-	"github.com/gorilla/websocket"
 )
 
 type Handler struct {
@@ -23,15 +18,34 @@ type Handler struct {
 	TaskRepo    *db.TaskRepository
 	RateLimiter *RateLimiter
 	WSHub       *WSHub
-}
+	OwnerCache  *OwnershipCache
+	// checks that a board's new owner exists
+	Users UserDirectory
+	// validates access tokens, loaded once at startup
+	JWTSecret string
+
+	// requests bearing this key in shared.InternalAPIKeyHeader bypass the rate limiter
+	InternalAPIKey string
+
+	// StrictBodies makes NoBodyMiddleware reject GET/DELETE requests with a body
+	StrictBodies bool
+	// AllowTrailingJSON accepts board/task bodies with data after the JSON value, for legacy clients
+	AllowTrailingJSON bool
+
+	// maximum number of ids in batch parameters, DefaultMaxBatchIDs if zero
+	MaxBatchIDs int
 
-type WSHub struct {
-	connections map[uuid.UUID]map[*websocket.Conn]bool
-	mutex       sync.Mutex
+	// users with the admin role, they may list soft-deleted items of any board
+	AdminUserIDs []string
 }
 
-func NewWSHub() *WSHub {
-	return &WSHub{connections: make(map[uuid.UUID]map[*websocket.Conn]bool)}
+func (h *Handler) isAdmin(userID string) bool {
+	for _, id := range h.AdminUserIDs {
+		if id == userID {
+			return true
+		}
+	}
+	return false
 }
 
 type RateLimiter struct {
@@ -39,6 +53,8 @@ type RateLimiter struct {
 	limit    int
 	mutex    sync.Mutex
 	window   time.Duration
+	// when the attempts are cleared next
+	resetAt time.Time
 }
 
 func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
@@ -46,6 +62,7 @@ func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
 		attempts: make(map[string]int),
 		limit:    limit,
 		window:   window,
+		resetAt:  time.Now().Add(window),
 	}
 	go rl.cleanup()
 	return rl
@@ -72,162 +89,45 @@ func (rl *RateLimiter) cleanup() {
 		time.Sleep(rl.window)
 		rl.mutex.Lock()
 		rl.attempts = make(map[string]int)
+		rl.resetAt = time.Now().Add(rl.window)
 		rl.mutex.Unlock()
 	}
 }
 
-func clientIP(r *http.Request) string {
-	if xf := r.Header.Get("X-Forwarded-For"); xf != "" {
-		parts := strings.Split(xf, ",")
-		return strings.TrimSpace(parts[0])
-	}
-	host, _, _ := net.SplitHostPort(r.RemoteAddr)
-	return host
-}
-
-// BroadcastTaskUpdate sends a task update to all WebSocket connections for a given board.
-func (h *WSHub) BroadcastTaskUpdate(boardID uuid.UUID, task *models.Task) {
-	h.mutex.Lock()
-	defer h.mutex.Unlock()
-
-	conns, exists := h.connections[boardID]
-	if !exists {
-		return
-	}
-
-	message, err := json.Marshal(map[string]any{
-		"event":   "task_updated",
-		"task_id": task.ID,
-		"title":   task.Title,
-		"status":  task.Status,
-	})
-	if err != nil {
-		log.Printf("Failed to marshal task update: %v", err)
-		return
-	}
-
-	for conn := range conns {
-		if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
-			log.Printf("Failed to send WebSocket message: %v", err)
-			delete(conns, conn)
-			conn.Close()
-		}
-	}
-}
-func (h *Handler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
-	clientIP := clientIP(r)
-	if !h.RateLimiter.Allow(clientIP) {
-		shared.SendError(w, "Too many WebSocket connection attempts", http.StatusTooManyRequests)
-		return
-	}
-
-	conn, boardID, _, err := h.upgradeAndAuthorize(w, r)
-	if err != nil {
-		log.Printf("WebSocket auth/upgrade failed: %v", err)
-		return
-	}
-
-	h.WSHub.register(boardID, conn)
-	h.setupKeepAlive(boardID, conn)
-
-	h.readLoop(boardID, conn)
+// Status reports the key's attempts in the current window without counting one
+func (rl *RateLimiter) Status(key string) (count, limit int, resetAt time.Time) {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	return rl.attempts[key], rl.limit, rl.resetAt
 }
 
-/*
-Upgrade the HTTP connection to a WebSocket and authorize the user for the specified board.
-*/
-func (h *Handler) upgradeAndAuthorize(w http.ResponseWriter, r *http.Request) (*websocket.Conn, uuid.UUID, string, error) {
-	upgrader := websocket.Upgrader{CheckOrigin: checkOrigin}
-	conn, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		return nil, uuid.Nil, "", err
-	}
-
-	boardIDStr := r.URL.Query().Get("board_id")
-	boardID, err := uuid.Parse(boardIDStr)
-	if err != nil {
-		conn.Close()
-		return nil, uuid.Nil, "", fmt.Errorf("invalid board id")
-	}
-
-	uid, _ := r.Context().Value("user_id").(string)
-	board, err := h.BoardRepo.GetByID(r.Context(), boardIDStr)
-	if err != nil || board.OwnerID.String() != uid {
-		conn.Close()
-		return nil, uuid.Nil, "", fmt.Errorf("forbidden")
-	}
-
-	return conn, boardID, uid, nil
+// Reset clears the key's attempts, e.g. for a client stuck at the limit
+func (rl *RateLimiter) Reset(key string) {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	delete(rl.attempts, key)
 }
 
-/*
-Check the Origin header against the allowed origins.
-If ALLOWED_ORIGINS is empty, allow all origins (for development).
-*/
-func checkOrigin(r *http.Request) bool {
-	// If ALLOWED_ORIGINS is empty, allow all origins
-	// (made for production use with specific origins only)
-	allowed := strings.Split(os.Getenv("ALLOWED_ORIGINS"), ",")
-	origin := r.Header.Get("Origin")
-
-	if len(allowed) == 0 || (len(allowed) == 1 && strings.TrimSpace(allowed[0]) == "") {
+// internal callers are never rate limited
+func (h *Handler) allowRequest(r *http.Request) bool {
+	if shared.IsInternalCaller(r, h.InternalAPIKey) {
 		return true
 	}
-
-	for _, a := range allowed {
-		if strings.TrimSpace(a) == origin {
-			return true
-		}
-	}
-	return false
+	return h.RateLimiter.Allow(clientIP(r))
 }
 
-func (hub *WSHub) register(boardID uuid.UUID, conn *websocket.Conn) {
-	hub.mutex.Lock()
-	defer hub.mutex.Unlock()
-	if hub.connections[boardID] == nil {
-		hub.connections[boardID] = make(map[*websocket.Conn]bool)
+func clientIP(r *http.Request) string {
+	if xf := r.Header.Get("X-Forwarded-For"); xf != "" {
+		parts := strings.Split(xf, ",")
+		return strings.TrimSpace(parts[0])
 	}
-	hub.connections[boardID][conn] = true
-}
-
-func (hub *WSHub) unregister(boardID uuid.UUID, conn *websocket.Conn) {
-	hub.mutex.Lock()
-	defer hub.mutex.Unlock()
-	delete(hub.connections[boardID], conn)
-}
-
-func (h *Handler) setupKeepAlive(boardID uuid.UUID, conn *websocket.Conn) {
-	conn.SetReadLimit(1 << 20)
-	conn.SetReadDeadline(time.Now().Add(60 * time.Second))
-	conn.SetPongHandler(func(string) error {
-		conn.SetReadDeadline(time.Now().Add(60 * time.Second))
-		return nil
-	})
-	go func() {
-		ticker := time.NewTicker(30 * time.Second)
-		defer ticker.Stop()
-		for {
-			<-ticker.C
-			if err := conn.WriteControl(
-				websocket.PingMessage, []byte{}, time.Now().Add(10*time.Second),
-			); err != nil {
-				h.WSHub.unregister(boardID, conn)
-				conn.Close()
-				return
-			}
-		}
-	}()
+	host, _, _ := net.SplitHostPort(r.RemoteAddr)
+	return host
 }
 
-func (h *Handler) readLoop(boardID uuid.UUID, conn *websocket.Conn) {
-	for {
-		_, _, err := conn.ReadMessage()
-		if err != nil {
-			log.Printf("WebSocket closed: %v", err)
-			h.WSHub.unregister(boardID, conn)
-			conn.Close()
-			break
-		}
+// log only when LOG_LEVEL=debug, for noisy client errors
+func debugf(format string, args ...any) {
+	if os.Getenv("LOG_LEVEL") == "debug" {
+		log.Printf("DEBUG: "+format, args...)
 	}
 }
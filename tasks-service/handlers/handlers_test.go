@@ -1,11 +1,14 @@
 package handlers
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"testing"
 	"time"
+
+	"github.com/chepyr/go-task-tracker/shared"
 )
 
 func TestClientIP_XForwardedFor(t *testing.T) {
@@ -27,6 +30,7 @@ func TestClientIP_RemoteAddr(t *testing.T) {
 }
 
 func TestCheckOrigin_EmptyAllowsAll(t *testing.T) {
+	t.Setenv("ENV", "development")
 	_ = os.Setenv("ALLOWED_ORIGINS", "")
 	req := httptest.NewRequest(http.MethodGet, "/", nil)
 	req.Header.Set("Origin", "https://any.example")
@@ -35,6 +39,22 @@ func TestCheckOrigin_EmptyAllowsAll(t *testing.T) {
 	}
 }
 
+func TestCheckOrigin_ProductionEmptyDeniesAll(t *testing.T) {
+	t.Setenv("ENV", "production")
+	t.Setenv("ALLOWED_ORIGINS", "")
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Origin", "https://any.example")
+	if checkOrigin(req) {
+		t.Fatalf("checkOrigin should deny when ALLOWED_ORIGINS is empty in production")
+	}
+
+	// allowing all in production must be explicit
+	t.Setenv("ALLOWED_ORIGINS", "*")
+	if !checkOrigin(req) {
+		t.Fatalf("checkOrigin should allow with ALLOWED_ORIGINS=*")
+	}
+}
+
 func TestCheckOrigin_ListAllowAndDeny(t *testing.T) {
 	_ = os.Setenv("ALLOWED_ORIGINS", "https://a.example, https://b.example")
 	allowReq := httptest.NewRequest(http.MethodGet, "/", nil)
@@ -66,3 +86,92 @@ func TestRateLimiter_AllowBlocksAndResets(t *testing.T) {
 		t.Fatalf("after window cleanup attempt should be allowed again")
 	}
 }
+
+func TestHandleWebSocket_InternalAPIKeyBypassesRateLimit(t *testing.T) {
+	h := &Handler{
+		RateLimiter:    NewRateLimiter(1, time.Minute),
+		WSHub:          NewWSHub(),
+		InternalAPIKey: "internal-key-for-tests",
+	}
+	h.RateLimiter.Allow("1.2.3.4") // exhaust the limit
+
+	newReq := func(key string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/ws", nil)
+		req.RemoteAddr = "1.2.3.4:5555"
+		req.Header.Set(shared.InternalAPIKeyHeader, key)
+		return req
+	}
+
+	recValid := httptest.NewRecorder()
+	h.HandleWebSocket(recValid, newReq("internal-key-for-tests"))
+	// not a real WebSocket handshake, so the upgrade itself fails with 400
+	if recValid.Code == http.StatusTooManyRequests {
+		t.Fatalf("valid internal key should bypass the rate limiter")
+	}
+
+	recInvalid := httptest.NewRecorder()
+	h.HandleWebSocket(recInvalid, newReq("wrong-key"))
+	if recInvalid.Code != http.StatusTooManyRequests {
+		t.Fatalf("invalid internal key: want 429, got %d", recInvalid.Code)
+	}
+}
+
+func TestRateLimit_StatusAndAdminReset(t *testing.T) {
+	admin := "admin-user"
+	h := &Handler{
+		RateLimiter:  NewRateLimiter(5, time.Minute),
+		AdminUserIDs: []string{admin},
+	}
+	h.RateLimiter.Allow("1.2.3.4")
+	h.RateLimiter.Allow("1.2.3.4")
+
+	status := func() (int, int, int) {
+		req := ctxWithUser("some-user", httptest.NewRequest(http.MethodGet, "/ratelimit/status", nil))
+		req.RemoteAddr = "1.2.3.4:5555"
+		rec := httptest.NewRecorder()
+		h.HandleRateLimit(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status: want 200, got %d body=%s", rec.Code, rec.Body.String())
+		}
+		var body struct {
+			Key       string    `json:"key"`
+			Count     int       `json:"count"`
+			Limit     int       `json:"limit"`
+			Remaining int       `json:"remaining"`
+			ResetAt   time.Time `json:"reset_at"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if body.Key != "1.2.3.4" || body.ResetAt.Before(time.Now()) {
+			t.Fatalf("unexpected status: %+v", body)
+		}
+		return body.Count, body.Limit, body.Remaining
+	}
+
+	// checking the status doesn't count as an attempt
+	for i := 0; i < 2; i++ {
+		if count, limit, remaining := status(); count != 2 || limit != 5 || remaining != 3 {
+			t.Fatalf("want 2/5 (3 remaining), got %d/%d (%d remaining)", count, limit, remaining)
+		}
+	}
+
+	reset := func(userID string) int {
+		req := ctxWithUser(userID, httptest.NewRequest(http.MethodDelete, "/ratelimit/1.2.3.4", nil))
+		rec := httptest.NewRecorder()
+		h.HandleRateLimit(rec, req)
+		return rec.Code
+	}
+	if code := reset("some-user"); code != http.StatusForbidden {
+		t.Fatalf("non-admin reset: want 403, got %d", code)
+	}
+	if count, _, _ := status(); count != 2 {
+		t.Fatalf("non-admin reset must not clear the count, got %d", count)
+	}
+	if code := reset(admin); code != http.StatusNoContent {
+		t.Fatalf("admin reset: want 204, got %d", code)
+	}
+	if count, _, remaining := status(); count != 0 || remaining != 5 {
+		t.Fatalf("after reset: want 0 (5 remaining), got %d (%d remaining)", count, remaining)
+	}
+}
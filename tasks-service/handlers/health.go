@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/chepyr/go-task-tracker/shared"
+)
+
+// how long /healthz/ws waits for the hub mutex before reporting the hub as busy
+const wsHealthLockWait = 50 * time.Millisecond
+
+/*
+GET /healthz/ws - report the boards and connections tracked by the hub
+and whether the broadcaster is running. 503 if the broadcaster is dead
+or the hub stayed locked, which usually means a stuck fan-out.
+The counts reveal how busy the service is, so only internal callers
+(monitoring with INTERNAL_API_KEY) may read them.
+*/
+func (h *Handler) HandleWSHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		shared.SendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !shared.IsInternalCaller(r, h.InternalAPIKey) {
+		shared.SendError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	stats, ok := h.WSHub.Stats(wsHealthLockWait)
+	response := struct {
+		Status string `json:"status"`
+		WSHubStats
+	}{Status: "ok", WSHubStats: stats}
+
+	status := http.StatusOK
+	switch {
+	case !stats.BroadcasterAlive:
+		response.Status = "broadcaster stopped"
+		status = http.StatusServiceUnavailable
+	case !ok:
+		response.Status = "hub busy"
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
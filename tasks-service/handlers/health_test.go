@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/chepyr/go-task-tracker/shared"
+	"github.com/google/uuid"
+)
+
+const testInternalKey = "internal-key-for-tests"
+
+func getWSHealth(t *testing.T, h *Handler) (int, WSHubStats, string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/healthz/ws", nil)
+	req.Header.Set(shared.InternalAPIKeyHeader, testInternalKey)
+	h.HandleWSHealth(rec, req)
+	var body struct {
+		Status string `json:"status"`
+		WSHubStats
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode health: %v body=%s", err, rec.Body.String())
+	}
+	return rec.Code, body.WSHubStats, body.Status
+}
+
+// the reported counts match the registered connections
+func TestHandleWSHealth_Counts(t *testing.T) {
+	p := newWSPair(t)
+	defer p.server.Close()
+
+	h := &Handler{WSHub: NewWSHub(), InternalAPIKey: testInternalKey}
+	boardA, boardB := uuid.New(), uuid.New()
+	for _, boardID := range []uuid.UUID{boardA, boardA, boardB} {
+		clientConn, serverConn := p.dial(t)
+		defer clientConn.Close()
+		h.WSHub.register(boardID, h.WSHub.newClient(serverConn))
+	}
+
+	code, stats, status := getWSHealth(t, h)
+	if code != http.StatusOK || status != "ok" {
+		t.Fatalf("want 200 ok, got %d %q", code, status)
+	}
+	want := WSHubStats{Boards: 2, Connections: 3, BroadcasterAlive: true}
+	if stats != want {
+		t.Fatalf("stats = %+v, want %+v", stats, want)
+	}
+}
+
+// a hub whose mutex stays held is reported busy instead of blocking the check
+func TestHandleWSHealth_BusyHub(t *testing.T) {
+	h := &Handler{WSHub: NewWSHub(), InternalAPIKey: testInternalKey}
+	h.WSHub.mutex.Lock()
+	defer h.WSHub.mutex.Unlock()
+
+	code, _, status := getWSHealth(t, h)
+	if code != http.StatusServiceUnavailable || status != "hub busy" {
+		t.Fatalf("want 503 hub busy, got %d %q", code, status)
+	}
+}
+
+// the stats are only served to internal callers
+func TestHandleWSHealth_RequiresInternalKey(t *testing.T) {
+	h := &Handler{WSHub: NewWSHub(), InternalAPIKey: testInternalKey}
+
+	for _, key := range []string{"", "wrong-key"} {
+		req := httptest.NewRequest(http.MethodGet, "/healthz/ws", nil)
+		if key != "" {
+			req.Header.Set(shared.InternalAPIKeyHeader, key)
+		}
+		rec := httptest.NewRecorder()
+		h.HandleWSHealth(rec, req)
+		if rec.Code != http.StatusForbidden {
+			t.Fatalf("key %q: want 403, got %d", key, rec.Code)
+		}
+	}
+}
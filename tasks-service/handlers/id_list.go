@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// default maximum number of ids in a batch parameter like board_ids
+const DefaultMaxBatchIDs = 100
+
+func (h *Handler) maxBatchIDs() int {
+	if h.MaxBatchIDs <= 0 {
+		return DefaultMaxBatchIDs
+	}
+	return h.MaxBatchIDs
+}
+
+/*
+Parse a comma-separated list of UUIDs from a batch parameter.
+The list is bounded, so a huge request can't turn into a huge IN (...) query.
+Duplicates are dropped.
+*/
+func parseIDList(raw string, max int) ([]uuid.UUID, error) {
+	parts := strings.Split(raw, ",")
+	if len(parts) > max {
+		return nil, fmt.Errorf("too many ids (max %d)", max)
+	}
+
+	ids := make([]uuid.UUID, 0, len(parts))
+	seen := make(map[uuid.UUID]bool, len(parts))
+	for _, part := range parts {
+		id, err := uuid.Parse(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("invalid id %q", part)
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
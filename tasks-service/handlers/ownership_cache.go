@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// how long an owner is cached when OWNER_CACHE_TTL is not set
+const DefaultOwnerCacheTTL = 30 * time.Second
+
+/*
+OwnershipCache remembers board owners for a short time, so task
+authorization doesn't have to load the board on every request.
+Every path that changes a board's owner or deletes a board must call
+Invalidate, otherwise a stale owner could keep access.
+A nil cache is valid and caches nothing.
+*/
+type OwnershipCache struct {
+	entries map[uuid.UUID]ownershipEntry
+	ttl     time.Duration
+	mutex   sync.Mutex
+}
+
+type ownershipEntry struct {
+	ownerID   uuid.UUID
+	expiresAt time.Time
+}
+
+func NewOwnershipCache(ttl time.Duration) *OwnershipCache {
+	return &OwnershipCache{
+		entries: make(map[uuid.UUID]ownershipEntry),
+		ttl:     ttl,
+	}
+}
+
+func (c *OwnershipCache) Get(boardID uuid.UUID) (uuid.UUID, bool) {
+	if c == nil {
+		return uuid.Nil, false
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, ok := c.entries[boardID]
+	if !ok {
+		return uuid.Nil, false
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(c.entries, boardID)
+		return uuid.Nil, false
+	}
+	return entry.ownerID, true
+}
+
+func (c *OwnershipCache) Set(boardID, ownerID uuid.UUID) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.entries[boardID] = ownershipEntry{ownerID: ownerID, expiresAt: time.Now().Add(c.ttl)}
+}
+
+func (c *OwnershipCache) Invalidate(boardID uuid.UUID) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.entries, boardID)
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/chepyr/go-task-tracker/shared"
+	"github.com/chepyr/go-task-tracker/shared/models"
+	"github.com/google/uuid"
+)
+
+type taskPermissions struct {
+	CanRead   bool `json:"can_read"`
+	CanWrite  bool `json:"can_write"`
+	CanDelete bool `json:"can_delete"`
+}
+
+// owner of the board, served from OwnerCache when possible
+func (h *Handler) boardOwner(ctx context.Context, boardID uuid.UUID) (uuid.UUID, error) {
+	if ownerID, ok := h.OwnerCache.Get(boardID); ok {
+		return ownerID, nil
+	}
+	board, err := h.BoardRepo.GetByID(ctx, boardID.String())
+	if err != nil {
+		return uuid.Nil, err
+	}
+	h.OwnerCache.Set(board.ID, board.OwnerID)
+	return board.OwnerID, nil
+}
+
+/*
+Check that the user may read every board, loading their roles in one query.
+Writes 404 if a board doesn't exist and 403 if the user has no role on one.
+*/
+func (h *Handler) requireBoardsReadable(ctx context.Context, w http.ResponseWriter, boardIDs []string, userID string) bool {
+	roles, err := h.BoardRepo.RolesByIDs(ctx, userID, boardIDs)
+	if err != nil {
+		log.Printf("Error loading board roles: %v", err)
+		shared.SendError(w, "Failed to load boards", http.StatusInternalServerError)
+		return false
+	}
+	if len(roles) != len(boardIDs) {
+		shared.SendError(w, "Board not found", http.StatusNotFound)
+		return false
+	}
+	for _, role := range roles {
+		if !permissionsForRole(role).CanRead {
+			shared.SendError(w, "Forbidden", http.StatusForbidden)
+			return false
+		}
+	}
+	return true
+}
+
+/*
+Resolve the user's role on the board.
+Returns an empty role if the user is neither the owner nor a member,
+and an error if the board can't be loaded.
+*/
+func (h *Handler) boardRole(ctx context.Context, boardID uuid.UUID, userID string) (models.BoardRole, error) {
+	ownerID, err := h.boardOwner(ctx, boardID)
+	if err != nil {
+		return "", err
+	}
+	if ownerID.String() == userID {
+		return models.BoardRoleOwner, nil
+	}
+	role, err := h.BoardRepo.GetMemberRole(ctx, boardID.String(), userID)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Failed to get role of user %s on board %s: %v", userID, boardID, err)
+		}
+		return "", nil
+	}
+	return role, nil
+}
+
+// task permissions a role grants on the board's tasks
+func permissionsForRole(role models.BoardRole) taskPermissions {
+	switch role {
+	case models.BoardRoleOwner, models.BoardRoleEditor:
+		return taskPermissions{CanRead: true, CanWrite: true, CanDelete: true}
+	case models.BoardRoleViewer:
+		return taskPermissions{CanRead: true}
+	default:
+		return taskPermissions{}
+	}
+}
+
+func (h *Handler) taskPermissions(ctx context.Context, boardID uuid.UUID, userID string) (taskPermissions, error) {
+	role, err := h.boardRole(ctx, boardID, userID)
+	if err != nil {
+		return taskPermissions{}, err
+	}
+	return permissionsForRole(role), nil
+}
+
+// GET /tasks/{id}/permissions
+func (h *Handler) getTaskPermissions(w http.ResponseWriter, r *http.Request, taskID uuid.UUID) {
+	userID, _ := r.Context().Value("user_id").(string)
+	if userID == "" {
+		shared.SendError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	task, err := h.TaskRepo.GetByID(ctx, taskID.String())
+	if err != nil || task == nil {
+		sendTaskLookupError(w, err)
+		return
+	}
+
+	perms, err := h.taskPermissions(ctx, task.BoardID, userID)
+	if err != nil {
+		shared.SendError(w, "Board not found", http.StatusNotFound)
+		return
+	}
+	if !perms.CanRead {
+		shared.SendError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(perms)
+}
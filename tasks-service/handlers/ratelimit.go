@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/chepyr/go-task-tracker/shared"
+)
+
+/*
+handles routes:
+- GET /ratelimit/status - the caller's bucket of the connection rate limiter
+- DELETE /ratelimit/{key} - admins only, clear a bucket
+*/
+func (h *Handler) HandleRateLimit(w http.ResponseWriter, r *http.Request) {
+	userID, _ := r.Context().Value("user_id").(string)
+	if userID == "" {
+		shared.SendError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, "/ratelimit/")
+	switch {
+	case key == "status" && r.Method == http.MethodGet:
+		h.rateLimitStatus(w, r)
+	case key != "" && key != "status" && r.Method == http.MethodDelete:
+		if !h.isAdmin(userID) {
+			shared.SendError(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		h.RateLimiter.Reset(key)
+		w.WriteHeader(http.StatusNoContent)
+	case key == "":
+		shared.SendError(w, "Not found", http.StatusNotFound)
+	default:
+		shared.SendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// the bucket is keyed by client IP, like in allowRequest
+func (h *Handler) rateLimitStatus(w http.ResponseWriter, r *http.Request) {
+	key := clientIP(r)
+	count, limit, resetAt := h.RateLimiter.Status(key)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Key       string    `json:"key"`
+		Count     int       `json:"count"`
+		Limit     int       `json:"limit"`
+		Remaining int       `json:"remaining"`
+		ResetAt   time.Time `json:"reset_at"`
+	}{key, count, limit, max(limit-count, 0), resetAt.UTC()})
+}
@@ -3,18 +3,26 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/chepyr/go-task-tracker/shared"
 	"github.com/chepyr/go-task-tracker/shared/models"
+	"github.com/chepyr/go-task-tracker/tasks-service/db"
 	"github.com/google/uuid"
 )
 
 /*
 handles routes:
-- GET /tasks?board_id={board_id} - list tasks for a board
+- GET /tasks?board_id={board_id}[&external_ref={ref}] - list tasks for a board
+- GET /tasks?board_id={board_id}&include_deleted=true - admins only, also soft-deleted tasks
+- GET /tasks?board_ids={id},{id},... - list tasks of several boards
+- GET /tasks?task_ids={id},{id},... - fetch several tasks by id
 - POST /tasks - create a new task
 */
 func (h *Handler) HandleTasks(w http.ResponseWriter, r *http.Request) {
@@ -39,8 +47,18 @@ func (h *Handler) listTasks(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if r.URL.Query().Has("board_ids") {
+		h.listTasksForBoards(w, r, userID)
+		return
+	}
+	if r.URL.Query().Has("task_ids") {
+		h.listTasksByIDs(w, r, userID)
+		return
+	}
+
 	boardIDStr := r.URL.Query().Get("board_id")
-	if _, err := uuid.Parse(boardIDStr); err != nil {
+	boardID, err := uuid.Parse(boardIDStr)
+	if err != nil {
 		shared.SendError(w, "board_id is required (uuid)", http.StatusBadRequest)
 		return
 	}
@@ -48,17 +66,54 @@ func (h *Handler) listTasks(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
 	defer cancel()
 
-	b, err := h.BoardRepo.GetByID(ctx, boardIDStr)
-	if err != nil || b == nil {
+	perms, err := h.taskPermissions(ctx, boardID, userID)
+	if err != nil {
 		shared.SendError(w, "Board not found", http.StatusNotFound)
 		return
 	}
-	if b.OwnerID.String() != userID {
+	// admins can read every board, include_deleted is ignored for everyone else
+	isAdmin := h.isAdmin(userID)
+	if !perms.CanRead && !isAdmin {
 		shared.SendError(w, "Forbidden", http.StatusForbidden)
 		return
 	}
+	includeDeleted := isAdmin && r.URL.Query().Get("include_deleted") == "true"
+
+	var tasks []*models.Task
+	if externalRef := r.URL.Query().Get("external_ref"); externalRef != "" {
+		tasks, err = h.TaskRepo.ListByExternalRef(ctx, boardIDStr, externalRef)
+	} else if includeDeleted {
+		tasks, err = h.TaskRepo.ListByBoardIDIncludingDeleted(ctx, boardIDStr)
+	} else {
+		tasks, err = h.TaskRepo.ListByBoardID(ctx, boardIDStr)
+	}
+	if err != nil {
+		shared.SendError(w, "Failed to list tasks", http.StatusInternalServerError)
+		return
+	}
+	sendTasksJSON(w, tasks)
+}
+
+// GET /tasks?board_ids=... - every board must be readable by the user
+func (h *Handler) listTasksForBoards(w http.ResponseWriter, r *http.Request, userID string) {
+	boardIDs, err := parseIDList(r.URL.Query().Get("board_ids"), h.maxBatchIDs())
+	if err != nil {
+		shared.SendError(w, "board_ids: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+
+	ids := make([]string, len(boardIDs))
+	for i, boardID := range boardIDs {
+		ids[i] = boardID.String()
+	}
+	if !h.requireBoardsReadable(ctx, w, ids, userID) {
+		return
+	}
 
-	tasks, err := h.TaskRepo.ListByBoardID(ctx, boardIDStr)
+	tasks, err := h.TaskRepo.ListByBoardIDs(ctx, ids)
 	if err != nil {
 		shared.SendError(w, "Failed to list tasks", http.StatusInternalServerError)
 		return
@@ -66,6 +121,45 @@ func (h *Handler) listTasks(w http.ResponseWriter, r *http.Request) {
 	sendTasksJSON(w, tasks)
 }
 
+// GET /tasks?task_ids=... - every task must exist and be on a board the user can read
+func (h *Handler) listTasksByIDs(w http.ResponseWriter, r *http.Request, userID string) {
+	taskIDs, err := parseIDList(r.URL.Query().Get("task_ids"), h.maxBatchIDs())
+	if err != nil {
+		shared.SendError(w, "task_ids: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+
+	ids := make([]string, len(taskIDs))
+	for i, taskID := range taskIDs {
+		ids[i] = taskID.String()
+	}
+	tasks, err := h.TaskRepo.ListByIDs(ctx, ids)
+	if err != nil {
+		shared.SendError(w, "Failed to list tasks", http.StatusInternalServerError)
+		return
+	}
+	if len(tasks) != len(ids) {
+		shared.SendError(w, "Task not found", http.StatusNotFound)
+		return
+	}
+
+	var boardIDs []string
+	seen := make(map[uuid.UUID]bool)
+	for _, task := range tasks {
+		if !seen[task.BoardID] {
+			seen[task.BoardID] = true
+			boardIDs = append(boardIDs, task.BoardID.String())
+		}
+	}
+	if !h.requireBoardsReadable(ctx, w, boardIDs, userID) {
+		return
+	}
+	sendTasksJSON(w, tasks)
+}
+
 func (h *Handler) createTask(w http.ResponseWriter, r *http.Request) {
 	userID, _ := r.Context().Value("user_id").(string)
 	if userID == "" {
@@ -83,8 +177,10 @@ func (h *Handler) createTask(w http.ResponseWriter, r *http.Request) {
 		Title       string `json:"title"`
 		Description string `json:"description"`
 		Status      string `json:"status"`
+		ExternalRef string `json:"external_ref"`
+		DueDate     string `json:"due_date"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+	if err := shared.DecodeJSON(r.Body, &input, h.AllowTrailingJSON); err != nil {
 		shared.SendError(w, "Invalid JSON body", http.StatusBadRequest)
 		return
 	}
@@ -92,6 +188,16 @@ func (h *Handler) createTask(w http.ResponseWriter, r *http.Request) {
 		shared.SendError(w, "title and board_id are required", http.StatusBadRequest)
 		return
 	}
+	externalRef, ok := parseExternalRef(input.ExternalRef)
+	if !ok {
+		shared.SendError(w, "external_ref too long (max 100 chars)", http.StatusBadRequest)
+		return
+	}
+	dueDate, err := parseDueDate(input.DueDate)
+	if err != nil {
+		shared.SendError(w, "due_date must be an RFC 3339 timestamp", http.StatusBadRequest)
+		return
+	}
 
 	boardID, err := uuid.Parse(input.BoardID)
 	if err != nil {
@@ -99,22 +205,22 @@ func (h *Handler) createTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// check if board exists and belongs to user
+	// check if board exists and the user may add tasks to it
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
-	board, err := h.BoardRepo.GetByID(ctx, input.BoardID)
-	if err != nil || board == nil {
+	perms, err := h.taskPermissions(ctx, boardID, userID)
+	if err != nil {
 		shared.SendError(w, "Board not found", http.StatusNotFound)
 		return
 	}
-	if board.OwnerID.String() != userID {
+	if !perms.CanWrite {
 		shared.SendError(w, "Forbidden", http.StatusForbidden)
 		return
 	}
 
-	status := normalizeStatus(input.Status)
-	if status == "" {
-		status = "todo"
+	status, ok := models.NormalizeTaskStatus(input.Status)
+	if !ok {
+		status = models.TaskStatusToDo
 	}
 	now := time.Now().UTC()
 	task := &models.Task{
@@ -122,7 +228,9 @@ func (h *Handler) createTask(w http.ResponseWriter, r *http.Request) {
 		BoardID:     boardID,
 		Title:       input.Title,
 		Description: input.Description,
-		Status:      models.TaskStatus(status),
+		Status:      status,
+		ExternalRef: externalRef,
+		DueDate:     dueDate,
 		CreatedAt:   now,
 		UpdatedAt:   now,
 	}
@@ -140,9 +248,10 @@ routes:
 - GET /tasks/{id},
 - PUT/PATCH /tasks/{id},
 - DELETE /tasks/{id}
+- GET /tasks/{id}/permissions
 */
 func (h *Handler) HandleTaskByID(w http.ResponseWriter, r *http.Request) {
-	taskIDstr := r.URL.Path[len("/tasks/"):]
+	taskIDstr, subresource, _ := strings.Cut(r.URL.Path[len("/tasks/"):], "/")
 	if taskIDstr == "" {
 		// TODO shared.SendError => shared.SendError
 		shared.SendError(w, "task_id is required", http.StatusBadRequest)
@@ -154,6 +263,20 @@ func (h *Handler) HandleTaskByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	switch subresource {
+	case "":
+	case "permissions":
+		if r.Method != http.MethodGet {
+			shared.SendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.getTaskPermissions(w, r, taskID)
+		return
+	default:
+		shared.SendError(w, "Not found", http.StatusNotFound)
+		return
+	}
+
 	switch r.Method {
 	case http.MethodGet:
 		h.getTaskByID(w, r, taskID)
@@ -179,16 +302,16 @@ func (h *Handler) getTaskByID(w http.ResponseWriter, r *http.Request, taskID uui
 
 	task, err := h.TaskRepo.GetByID(ctx, taskID.String())
 	if err != nil || task == nil {
-		shared.SendError(w, "Task not found", http.StatusNotFound)
+		sendTaskLookupError(w, err)
 		return
 	}
 
-	board, err := h.BoardRepo.GetByID(ctx, task.BoardID.String())
-	if err != nil || board == nil {
+	perms, err := h.taskPermissions(ctx, task.BoardID, userID)
+	if err != nil {
 		shared.SendError(w, "Board not found", http.StatusNotFound)
 		return
 	}
-	if board.OwnerID.String() != userID {
+	if !perms.CanRead {
 		shared.SendError(w, "Forbidden", http.StatusForbidden)
 		return
 	}
@@ -213,16 +336,16 @@ func (h *Handler) updateTaskByID(w http.ResponseWriter, r *http.Request, taskID
 
 	existingTask, err := h.TaskRepo.GetByID(ctx, taskID.String())
 	if err != nil || existingTask == nil {
-		shared.SendError(w, "Task not found", http.StatusNotFound)
+		sendTaskLookupError(w, err)
 		return
 	}
 
-	board, err := h.BoardRepo.GetByID(ctx, existingTask.BoardID.String())
-	if err != nil || board == nil {
+	perms, err := h.taskPermissions(ctx, existingTask.BoardID, userID)
+	if err != nil {
 		shared.SendError(w, "Board not found", http.StatusNotFound)
 		return
 	}
-	if board.OwnerID.String() != userID {
+	if !perms.CanWrite {
 		shared.SendError(w, "Forbidden", http.StatusForbidden)
 		return
 	}
@@ -231,12 +354,16 @@ func (h *Handler) updateTaskByID(w http.ResponseWriter, r *http.Request, taskID
 		Title       *string `json:"title"`
 		Description *string `json:"description"`
 		Status      *string `json:"status"`
+		ExternalRef *string `json:"external_ref"`
+		DueDate     *string `json:"due_date"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+	if err := shared.DecodeJSON(r.Body, &input, h.AllowTrailingJSON); err != nil {
 		shared.SendError(w, "Invalid JSON body", http.StatusBadRequest)
 		return
 	}
 
+	previousStatus := existingTask.Status
+
 	// TODO: move validation to new functions
 	if input.Title != nil {
 		title := strings.TrimSpace(*input.Title)
@@ -259,16 +386,46 @@ func (h *Handler) updateTaskByID(w http.ResponseWriter, r *http.Request, taskID
 		existingTask.Description = desc
 	}
 	if input.Status != nil {
-		status := normalizeStatus(*input.Status)
-		if status == "" {
+		// an empty status resets the task to to_do
+		status, ok := models.NormalizeTaskStatus(*input.Status)
+		if !ok {
 			shared.SendError(w, "Invalid status value", http.StatusBadRequest)
 			return
 		}
-		existingTask.Status = models.TaskStatus(status)
+		existingTask.Status = status
+	}
+	if input.ExternalRef != nil {
+		// an empty external_ref clears the reference
+		externalRef, ok := parseExternalRef(*input.ExternalRef)
+		if !ok {
+			shared.SendError(w, "external_ref too long (max 100 chars)", http.StatusBadRequest)
+			return
+		}
+		existingTask.ExternalRef = externalRef
+	}
+	if input.DueDate != nil {
+		// an empty due_date clears it
+		dueDate, err := parseDueDate(*input.DueDate)
+		if err != nil {
+			shared.SendError(w, "due_date must be an RFC 3339 timestamp", http.StatusBadRequest)
+			return
+		}
+		existingTask.DueDate = dueDate
 	}
 	existingTask.UpdatedAt = time.Now().UTC()
 
-	if err := h.TaskRepo.Update(ctx, existingTask); err != nil {
+	if existingTask.Status != previousStatus {
+		change, err := statusChangeFromContext(r.Context(), existingTask, previousStatus)
+		if err != nil {
+			log.Printf("Cannot record status change of task %s: %v", existingTask.ID, err)
+			shared.SendError(w, "Cannot record status change", http.StatusInternalServerError)
+			return
+		}
+		err = h.TaskRepo.UpdateWithStatusChange(ctx, existingTask, change)
+	} else {
+		err = h.TaskRepo.Update(ctx, existingTask)
+	}
+	if err != nil {
 		shared.SendError(w, "Failed to update task", http.StatusInternalServerError)
 		return
 	}
@@ -288,16 +445,16 @@ func (h *Handler) deleteTaskByID(w http.ResponseWriter, r *http.Request, taskID
 
 	existingTask, err := h.TaskRepo.GetByID(ctx, taskID.String())
 	if err != nil || existingTask == nil {
-		shared.SendError(w, "Task not found", http.StatusNotFound)
+		sendTaskLookupError(w, err)
 		return
 	}
 
-	board, err := h.BoardRepo.GetByID(ctx, existingTask.BoardID.String())
-	if err != nil || board == nil {
+	perms, err := h.taskPermissions(ctx, existingTask.BoardID, userID)
+	if err != nil {
 		shared.SendError(w, "Board not found", http.StatusNotFound)
 		return
 	}
-	if board.OwnerID.String() != userID {
+	if !perms.CanDelete {
 		shared.SendError(w, "Forbidden", http.StatusForbidden)
 		return
 	}
@@ -311,21 +468,105 @@ func (h *Handler) deleteTaskByID(w http.ResponseWriter, r *http.Request, taskID
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// a task that fails the strict status check is a data error, not a missing task
+func sendTaskLookupError(w http.ResponseWriter, err error) {
+	if errors.Is(err, db.ErrNonCanonicalStatus) {
+		log.Printf("Task lookup failed: %v", err)
+		shared.SendError(w, "Task has an invalid stored status", http.StatusInternalServerError)
+		return
+	}
+	shared.SendError(w, "Task not found", http.StatusNotFound)
+}
+
+/*
+Build the audit record of a status transition.
+The acting user is taken from the request context set by AuthMiddleware,
+so a shared board's history shows who actually made the change.
+A missing user means the middleware was bypassed and is an error.
+*/
+func statusChangeFromContext(
+	ctx context.Context, task *models.Task, from models.TaskStatus,
+) (*models.TaskStatusChange, error) {
+	userID, _ := ctx.Value("user_id").(string)
+	changedBy, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, fmt.Errorf("no valid user_id in context: %q", userID)
+	}
+	return &models.TaskStatusChange{
+		ID:         uuid.New(),
+		TaskID:     task.ID,
+		FromStatus: from,
+		ToStatus:   task.Status,
+		ChangedBy:  changedBy,
+		ChangedAt:  task.UpdatedAt,
+	}, nil
+}
+
+// number of streamed tasks between flushes
+const tasksFlushInterval = 100
+
+/*
+Stream the tasks as a JSON array element by element,
+so the encoded response is never held in memory as a whole.
+*/
 func sendTasksJSON(w http.ResponseWriter, tasks []*models.Task) {
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(tasks)
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+
+	if _, err := io.WriteString(w, "["); err != nil {
+		log.Printf("Failed to write tasks response: %v", err)
+		return
+	}
+	for i, task := range tasks {
+		if i > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				log.Printf("Failed to write tasks response: %v", err)
+				return
+			}
+		}
+		// headers are already sent, so a failure mid-stream can only be logged
+		if err := enc.Encode(task); err != nil {
+			log.Printf("Failed to stream task %s: %v", task.ID, err)
+			return
+		}
+		if flusher != nil && (i+1)%tasksFlushInterval == 0 {
+			flusher.Flush()
+		}
+	}
+	if _, err := io.WriteString(w, "]"); err != nil {
+		log.Printf("Failed to write tasks response: %v", err)
+	}
 }
 
-// convert various user inputs to standard status values
-func normalizeStatus(s string) string {
-	switch strings.ToLower(strings.TrimSpace(s)) {
-	case "", "todo":
-		return "todo"
-	case "in-progress", "in_progress", "inprogress", "in progress":
-		return "in-progress"
-	case "done":
-		return "done"
-	default:
-		return ""
+const maxExternalRefLength = 100
+
+// trim the external reference, empty means no reference (nil)
+func parseExternalRef(s string) (*string, bool) {
+	ref := strings.TrimSpace(s)
+	if ref == "" {
+		return nil, true
+	}
+	if len(ref) > maxExternalRefLength {
+		return nil, false
+	}
+	return &ref, true
+}
+
+/*
+Parse an RFC 3339 due date and normalize it to UTC,
+so "2024-06-01T00:00:00+09:00" is stored and returned as "2024-05-31T15:00:00Z".
+Empty means no due date (nil).
+*/
+func parseDueDate(s string) (*time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	due, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return nil, err
 	}
+	due = due.UTC()
+	return &due, nil
 }
@@ -2,15 +2,17 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/chepyr/go-task-tracker/shared/models"
 	tdb "github.com/chepyr/go-task-tracker/tasks-service/db"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
@@ -21,7 +23,6 @@ func setupHTTP(t *testing.T) (*Handler, *http.ServeMux, *sql.DB, string) {
 	t.Helper()
 
 	secret := strings.Repeat("a", 32)
-	_ = os.Setenv("JWT_SECRET", secret)
 
 	// in-memory sqlite DB
 	dbx, err := sql.Open("sqlite3", ":memory:")
@@ -34,17 +35,38 @@ CREATE TABLE boards (
   owner_id TEXT NOT NULL,
   title TEXT NOT NULL,
   description TEXT,
+  external_ref TEXT,
+  position INTEGER NOT NULL DEFAULT 0,
   created_at TIMESTAMP NOT NULL,
   updated_at TIMESTAMP NOT NULL
 );
+CREATE UNIQUE INDEX idx_boards_owner_id_external_ref ON boards(owner_id, external_ref);
 CREATE TABLE tasks (
   id TEXT PRIMARY KEY,
   board_id TEXT NOT NULL,
   title TEXT NOT NULL,
   description TEXT,
   status TEXT NOT NULL,
+  external_ref TEXT,
+  due_date TIMESTAMP,
   created_at TIMESTAMP NOT NULL,
-  updated_at TIMESTAMP NOT NULL
+  updated_at TIMESTAMP NOT NULL,
+  deleted_at TIMESTAMP
+);
+CREATE TABLE task_status_history (
+  id TEXT PRIMARY KEY,
+  task_id TEXT NOT NULL,
+  from_status TEXT NOT NULL,
+  to_status TEXT NOT NULL,
+  changed_by TEXT NOT NULL,
+  changed_at TIMESTAMP NOT NULL
+);
+CREATE TABLE board_members (
+  board_id TEXT NOT NULL,
+  user_id TEXT NOT NULL,
+  role TEXT NOT NULL,
+  created_at TIMESTAMP NOT NULL,
+  PRIMARY KEY (board_id, user_id)
 );
 `
 	if _, err := dbx.Exec(ddl); err != nil {
@@ -56,6 +78,8 @@ CREATE TABLE tasks (
 		TaskRepo:    tdb.NewTaskRepository(dbx),
 		RateLimiter: NewRateLimiter(5, time.Second),
 		WSHub:       NewWSHub(),
+		OwnerCache:  NewOwnershipCache(time.Minute),
+		JWTSecret:   secret,
 	}
 
 	mux := http.NewServeMux()
@@ -82,6 +106,46 @@ func bearerForUser(t *testing.T, secret, userID string) string {
 	return "Bearer " + signed
 }
 
+// testAPI sends authenticated requests through the mux returned by setupHTTP
+type testAPI struct {
+	t      *testing.T
+	mux    http.Handler
+	secret string
+}
+
+// send a request as userID, a non-empty body is sent as JSON
+func (a testAPI) send(userID, method, path, body string) *httptest.ResponseRecorder {
+	a.t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", bearerForUser(a.t, a.secret, userID))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	rec := httptest.NewRecorder()
+	a.mux.ServeHTTP(rec, req)
+	return rec
+}
+
+// create a board owned by userID and return its id
+func (a testAPI) createBoard(userID, title string) string {
+	a.t.Helper()
+	rec := a.send(userID, http.MethodPost, "/boards", `{"title":"`+title+`"}`)
+	if rec.Code != http.StatusCreated {
+		a.t.Fatalf("create board status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	return strings.TrimPrefix(rec.Header().Get("Location"), "/boards/")
+}
+
+// create a task on the board as userID and return its id
+func (a testAPI) createTask(userID, boardID, title string) string {
+	a.t.Helper()
+	rec := a.send(userID, http.MethodPost, "/tasks", `{"board_id":"`+boardID+`","title":"`+title+`"}`)
+	if rec.Code != http.StatusOK {
+		a.t.Fatalf("create task status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	return strings.TrimPrefix(rec.Header().Get("Location"), "/tasks/")
+}
+
 func TestBoardsAndTasks_HappyPath(t *testing.T) {
 	_, mux, dbx, secret := setupHTTP(t)
 	defer dbx.Close()
@@ -133,7 +197,7 @@ func TestBoardsAndTasks_HappyPath(t *testing.T) {
 	if err := json.Unmarshal(rec2.Body.Bytes(), &created); err != nil {
 		t.Fatalf("decode created task: %v", err)
 	}
-	if len(created) != 1 || created[0].Title != "Task #1" || created[0].Status != "todo" {
+	if len(created) != 1 || created[0].Title != "Task #1" || created[0].Status != string(models.TaskStatusToDo) {
 		t.Fatalf("unexpected created task: %+v", created)
 	}
 
@@ -163,32 +227,16 @@ func TestBoardsAndTasks_HappyPath(t *testing.T) {
 func TestTasks_Create_ForbiddenForForeignBoard(t *testing.T) {
 	_, mux, dbx, secret := setupHTTP(t)
 	defer dbx.Close()
+	api := testAPI{t, mux, secret}
 
 	userA := uuid.New().String()
 	userB := uuid.New().String()
-	authA := bearerForUser(t, secret, userA)
-	authB := bearerForUser(t, secret, userB)
-
-	req := httptest.NewRequest(http.MethodPost, "/boards", bytes.NewBufferString(`{"title":"A"}`))
-	req.Header.Set("Authorization", authA)
-	req.Header.Set("Content-Type", "application/json")
-	rec := httptest.NewRecorder()
-	mux.ServeHTTP(rec, req)
-	if rec.Code != http.StatusCreated {
-		t.Fatalf("create board status=%d", rec.Code)
-	}
-	boardID := strings.TrimPrefix(rec.Header().Get("Location"), "/boards/")
+	boardID := api.createBoard(userA, "A")
 
 	// userB tries to create task on userA's board
-	task := `{"board_id":"` + boardID + `","title":"x"}`
-	req2 := httptest.NewRequest(http.MethodPost, "/tasks", bytes.NewBufferString(task))
-	req2.Header.Set("Authorization", authB)
-	req2.Header.Set("Content-Type", "application/json")
-	rec2 := httptest.NewRecorder()
-	mux.ServeHTTP(rec2, req2)
-
-	if rec2.Code != http.StatusForbidden {
-		t.Fatalf("expected 403, got %d body=%s", rec2.Code, rec2.Body.String())
+	rec := api.send(userB, http.MethodPost, "/tasks", `{"board_id":"`+boardID+`","title":"x"}`)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d body=%s", rec.Code, rec.Body.String())
 	}
 }
 
@@ -197,72 +245,22 @@ func TestTasks_Create_ForbiddenForForeignBoard(t *testing.T) {
 func TestTask_ByID_ForbiddenForNonOwner(t *testing.T) {
 	_, mux, dbx, secret := setupHTTP(t)
 	defer dbx.Close()
+	api := testAPI{t, mux, secret}
 
 	userA := uuid.New().String()
 	userB := uuid.New().String()
-	authA := bearerForUser(t, secret, userA)
-	authB := bearerForUser(t, secret, userB)
-
-	// userA creates a board
-	reqBoard := httptest.NewRequest(http.MethodPost, "/boards", bytes.NewBufferString(`{"title":"A"}`))
-	reqBoard.Header.Set("Authorization", authA)
-	reqBoard.Header.Set("Content-Type", "application/json")
-	recBoard := httptest.NewRecorder()
-	mux.ServeHTTP(recBoard, reqBoard)
-	if recBoard.Code != http.StatusCreated {
-		t.Fatalf("create board status=%d", recBoard.Code)
-	}
-	boardID := strings.TrimPrefix(recBoard.Header().Get("Location"), "/boards/")
-
-	// userA creates a task
-	taskBody := `{"board_id":"` + boardID + `","title":"Task 1"}`
-	reqTask := httptest.NewRequest(http.MethodPost, "/tasks", bytes.NewBufferString(taskBody))
-	reqTask.Header.Set("Authorization", authA)
-	reqTask.Header.Set("Content-Type", "application/json")
-	recTask := httptest.NewRecorder()
-	mux.ServeHTTP(recTask, reqTask)
-	if recTask.Code != http.StatusOK {
-		t.Fatalf("create task status=%d", recTask.Code)
-	}
-	var createdTasks []struct {
-		ID string `json:"id"`
-	}
-	if err := json.Unmarshal(recTask.Body.Bytes(), &createdTasks); err != nil || len(createdTasks) == 0 {
-		t.Fatalf("decode created task: %v", err)
-	}
-	taskID := createdTasks[0].ID
+	taskID := api.createTask(userA, api.createBoard(userA, "A"), "Task 1")
 
-	// userB trieds to get userA's task
-	reqGet := httptest.NewRequest(http.MethodGet, "/tasks/"+taskID, nil)
-	reqGet.Header.Set("Authorization", authB)
-	reqGet.Header.Set("Content-Type", "application/json")
-	recGet := httptest.NewRecorder()
-	mux.ServeHTTP(recGet, reqGet)
-	if recGet.Code != http.StatusForbidden {
-		t.Fatalf("expected 403, got %d body=%s", recGet.Code,
-			recGet.Body.String())
+	// userB tries to get, update and delete userA's task
+	requests := []struct{ method, body string }{
+		{http.MethodGet, ""},
+		{http.MethodPut, `{"title":"updated title"}`},
+		{http.MethodDelete, ""},
 	}
-
-	// userB tries to update userA's task
-	updateBody := `{"title":"updated title"}`
-	reqUpdate := httptest.NewRequest(http.MethodPut, "/tasks/"+taskID, bytes.NewBufferString(updateBody))
-	reqUpdate.Header.Set("Authorization", authB)
-	reqUpdate.Header.Set("Content-Type", "application/json")
-	recUpdate := httptest.NewRecorder()
-	mux.ServeHTTP(recUpdate, reqUpdate)
-
-	if recUpdate.Code != http.StatusForbidden {
-		t.Fatalf("expected 403, got %d body=%s", recUpdate.Code, recUpdate.Body.String())
-	}
-
-	// userB tries to delete userA's task
-	reqDelete := httptest.NewRequest(http.MethodDelete, "/tasks/"+taskID, nil)
-	reqDelete.Header.Set("Authorization", authB)
-	reqDelete.Header.Set("Content-Type", "application/json")
-	recDelete := httptest.NewRecorder()
-	mux.ServeHTTP(recDelete, reqDelete)
-	if recDelete.Code != http.StatusForbidden {
-		t.Fatalf("expected 403, got %d body=%s", recDelete.Code, recDelete.Body.String())
+	for _, r := range requests {
+		if rec := api.send(userB, r.method, "/tasks/"+taskID, r.body); rec.Code != http.StatusForbidden {
+			t.Fatalf("%s: expected 403, got %d body=%s", r.method, rec.Code, rec.Body.String())
+		}
 	}
 }
 
@@ -295,3 +293,673 @@ _id":"some-board","title":"x"}`},
 		}
 	}
 }
+
+// owner gets all permissions, a viewer member gets read only,
+// a non-member is forbidden
+func TestTask_Permissions(t *testing.T) {
+	h, mux, dbx, secret := setupHTTP(t)
+	defer dbx.Close()
+	api := testAPI{t, mux, secret}
+
+	owner := uuid.New().String()
+	editor := uuid.New()
+	viewer := uuid.New()
+	boardID := api.createBoard(owner, "A")
+	taskID := api.createTask(owner, boardID, "Task 1")
+
+	for userID, role := range map[uuid.UUID]models.BoardRole{editor: models.BoardRoleEditor, viewer: models.BoardRoleViewer} {
+		err := h.BoardRepo.AddMember(context.Background(), &models.BoardMember{
+			BoardID:   uuid.MustParse(boardID),
+			UserID:    userID,
+			Role:      role,
+			CreatedAt: time.Now().UTC(),
+		})
+		if err != nil {
+			t.Fatalf("add %s: %v", role, err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		userID string
+		want   taskPermissions
+	}{
+		{"owner", owner, taskPermissions{CanRead: true, CanWrite: true, CanDelete: true}},
+		{"editor", editor.String(), taskPermissions{CanRead: true, CanWrite: true, CanDelete: true}},
+		{"viewer", viewer.String(), taskPermissions{CanRead: true}},
+		{"non-member", uuid.New().String(), taskPermissions{}},
+	}
+	// the task endpoints grant exactly what the flags report
+	allowed := func(flag bool, okStatus int) int {
+		if flag {
+			return okStatus
+		}
+		return http.StatusForbidden
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := api.send(tt.userID, http.MethodGet, "/tasks/"+taskID+"/permissions", "")
+			if rec.Code != allowed(tt.want.CanRead, http.StatusOK) {
+				t.Fatalf("permissions: got %d body=%s", rec.Code, rec.Body.String())
+			}
+			if tt.want.CanRead {
+				var got taskPermissions
+				if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+					t.Fatalf("decode: %v", err)
+				}
+				if got != tt.want {
+					t.Fatalf("permissions = %+v, want %+v", got, tt.want)
+				}
+			}
+
+			ownTaskID := api.createTask(owner, boardID, "to delete")
+			checks := []struct {
+				method, path, body string
+				want               int
+			}{
+				{http.MethodGet, "/tasks/" + taskID, "", allowed(tt.want.CanRead, http.StatusOK)},
+				{http.MethodGet, "/tasks?board_id=" + boardID, "", allowed(tt.want.CanRead, http.StatusOK)},
+				{http.MethodPatch, "/tasks/" + taskID, `{"title":"by ` + tt.name + `"}`, allowed(tt.want.CanWrite, http.StatusOK)},
+				{http.MethodPost, "/tasks", `{"board_id":"` + boardID + `","title":"x"}`, allowed(tt.want.CanWrite, http.StatusOK)},
+				{http.MethodDelete, "/tasks/" + ownTaskID, "", allowed(tt.want.CanDelete, http.StatusNoContent)},
+			}
+			for _, c := range checks {
+				if rec := api.send(tt.userID, c.method, c.path, c.body); rec.Code != c.want {
+					t.Fatalf("%s %s: want %d, got %d body=%s", c.method, c.path, c.want, rec.Code, rec.Body.String())
+				}
+			}
+		})
+	}
+}
+
+// after a transfer the cached owner must not be served:
+// the previous owner is denied and the new owner is allowed
+func TestBoardTransfer_InvalidatesOwnershipCache(t *testing.T) {
+	h, mux, dbx, secret := setupHTTP(t)
+	defer dbx.Close()
+	api := testAPI{t, mux, secret}
+
+	userA := uuid.New().String()
+	userB := uuid.New().String()
+	h.Users = fakeUserDirectory{uuid.MustParse(userB): true}
+
+	boardID := api.createBoard(userA, "A")
+	taskID := api.createTask(userA, boardID, "Task 1")
+	getTask := func(userID string) int {
+		return api.send(userID, http.MethodGet, "/tasks/"+taskID, "").Code
+	}
+
+	// warms the cache with userA as owner
+	if code := getTask(userA); code != http.StatusOK {
+		t.Fatalf("owner get task: want 200, got %d", code)
+	}
+	if owner, ok := h.OwnerCache.Get(uuid.MustParse(boardID)); !ok || owner.String() != userA {
+		t.Fatalf("expected cached owner %s, got %s (cached=%v)", userA, owner, ok)
+	}
+
+	rec := api.send(userA, http.MethodPost, "/boards/"+boardID+"/transfer", `{"owner_id":"`+userB+`"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("transfer: want 200, got %d body=%s", rec.Code, rec.Body.String())
+	}
+
+	if code := getTask(userA); code != http.StatusForbidden {
+		t.Fatalf("previous owner get task: want 403, got %d", code)
+	}
+	if code := getTask(userB); code != http.StatusOK {
+		t.Fatalf("new owner get task: want 200, got %d", code)
+	}
+
+	// deleting the board drops the cached owner as well
+	if rec := api.send(userB, http.MethodDelete, "/boards/"+boardID, ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete board: want 204, got %d", rec.Code)
+	}
+	if _, ok := h.OwnerCache.Get(uuid.MustParse(boardID)); ok {
+		t.Fatalf("cache entry should be invalidated after delete")
+	}
+}
+
+type fakeUserDirectory map[uuid.UUID]bool
+
+func (d fakeUserDirectory) UserExists(ctx context.Context, userID uuid.UUID) (bool, error) {
+	return d[userID], nil
+}
+
+type failingUserDirectory struct{}
+
+func (failingUserDirectory) UserExists(ctx context.Context, userID uuid.UUID) (bool, error) {
+	return false, errors.New("auth service unavailable")
+}
+
+// a successful board update drops the board's cached owner
+func TestBoardUpdate_InvalidatesOwnershipCache(t *testing.T) {
+	h, mux, dbx, secret := setupHTTP(t)
+	defer dbx.Close()
+	api := testAPI{t, mux, secret}
+
+	owner := uuid.New().String()
+	boardID := api.createBoard(owner, "A")
+	h.OwnerCache.Set(uuid.MustParse(boardID), uuid.MustParse(owner))
+
+	if rec := api.send(owner, http.MethodPut, "/boards/"+boardID, `{"title":"B"}`); rec.Code != http.StatusOK {
+		t.Fatalf("update board: want 200, got %d body=%s", rec.Code, rec.Body.String())
+	}
+	if _, ok := h.OwnerCache.Get(uuid.MustParse(boardID)); ok {
+		t.Fatalf("cache entry should be invalidated after update")
+	}
+}
+
+// the new owner must be a known user, and a failed lookup doesn't transfer the board
+func TestBoardTransfer_ValidatesNewOwner(t *testing.T) {
+	h, mux, dbx, secret := setupHTTP(t)
+	defer dbx.Close()
+	api := testAPI{t, mux, secret}
+
+	owner := uuid.New().String()
+	boardID := api.createBoard(owner, "A")
+	transfer := func(newOwner string) int {
+		return api.send(owner, http.MethodPost, "/boards/"+boardID+"/transfer", `{"owner_id":"`+newOwner+`"}`).Code
+	}
+
+	h.Users = fakeUserDirectory{}
+	if code := transfer(uuid.New().String()); code != http.StatusBadRequest {
+		t.Fatalf("unknown user: want 400, got %d", code)
+	}
+
+	h.Users = failingUserDirectory{}
+	if code := transfer(uuid.New().String()); code != http.StatusBadGateway {
+		t.Fatalf("failed lookup: want 502, got %d", code)
+	}
+
+	board, err := h.BoardRepo.GetByID(context.Background(), boardID)
+	if err != nil {
+		t.Fatalf("get board: %v", err)
+	}
+	if board.OwnerID.String() != owner {
+		t.Fatalf("owner changed to %s without a valid transfer", board.OwnerID)
+	}
+}
+
+// external_ref can be set on create, used as a filter, and cleared on update
+func TestTask_ExternalRef(t *testing.T) {
+	_, mux, dbx, secret := setupHTTP(t)
+	defer dbx.Close()
+	api := testAPI{t, mux, secret}
+
+	user := uuid.New().String()
+	boardID := api.createBoard(user, "A")
+	createTask := func(body string) *httptest.ResponseRecorder {
+		return api.send(user, http.MethodPost, "/tasks", body)
+	}
+	type taskResp struct {
+		ID          string `json:"id"`
+		Title       string `json:"title"`
+		ExternalRef *string
+	}
+
+	// 1) set on create
+	rec := createTask(`{"board_id":"` + boardID + `","title":"linked","external_ref":"JIRA-42"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("create linked task status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	var created []taskResp
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatalf("decode created task: %v", err)
+	}
+	if len(created) != 1 || created[0].ExternalRef == nil || *created[0].ExternalRef != "JIRA-42" {
+		t.Fatalf("unexpected created task: %+v", created)
+	}
+	linkedID := created[0].ID
+
+	api.createTask(user, boardID, "plain")
+	tooLong := strings.Repeat("r", maxExternalRefLength+1)
+	if rec := createTask(`{"board_id":"` + boardID + `","title":"x","external_ref":"` + tooLong + `"}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("too long external_ref: want 400, got %d", rec.Code)
+	}
+
+	// 2) filter
+	listByRef := func(ref string) []taskResp {
+		rec := api.send(user, http.MethodGet, "/tasks?board_id="+boardID+"&external_ref="+ref, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("list by external_ref status=%d", rec.Code)
+		}
+		var listed []taskResp
+		if err := json.Unmarshal(rec.Body.Bytes(), &listed); err != nil {
+			t.Fatalf("decode list: %v", err)
+		}
+		return listed
+	}
+	if listed := listByRef("JIRA-42"); len(listed) != 1 || listed[0].ID != linkedID {
+		t.Fatalf("filter by external_ref: unexpected list %+v", listed)
+	}
+
+	// 3) clear with an empty string
+	recUpdate := api.send(user, http.MethodPatch, "/tasks/"+linkedID, `{"external_ref":""}`)
+	if recUpdate.Code != http.StatusOK {
+		t.Fatalf("clear external_ref status=%d body=%s", recUpdate.Code, recUpdate.Body.String())
+	}
+	var updated []taskResp
+	if err := json.Unmarshal(recUpdate.Body.Bytes(), &updated); err != nil {
+		t.Fatalf("decode updated task: %v", err)
+	}
+	if len(updated) != 1 || updated[0].ExternalRef != nil {
+		t.Fatalf("external_ref should be cleared: %+v", updated)
+	}
+	if listed := listByRef("JIRA-42"); len(listed) != 0 {
+		t.Fatalf("cleared task still matches filter: %+v", listed)
+	}
+}
+
+// a large task list is streamed as one valid JSON array
+func TestListTasks_StreamsValidJSON(t *testing.T) {
+	h, mux, dbx, secret := setupHTTP(t)
+	defer dbx.Close()
+
+	owner := uuid.New()
+	authz := bearerForUser(t, secret, owner.String())
+
+	boardID := uuid.New()
+	now := time.Now().UTC()
+	err := h.BoardRepo.Create(context.Background(), &models.Board{
+		ID: boardID, OwnerID: owner, Title: "Big board", CreatedAt: now, UpdatedAt: now,
+	})
+	if err != nil {
+		t.Fatalf("create board: %v", err)
+	}
+
+	list := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/tasks?board_id="+boardID.String(), nil)
+		req.Header.Set("Authorization", authz)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET /tasks status=%d body=%s", rec.Code, rec.Body.String())
+		}
+		return rec
+	}
+
+	// empty board is an empty array, not null
+	if body := strings.TrimSpace(list().Body.String()); body != "[]" {
+		t.Fatalf("empty list body = %q, want []", body)
+	}
+
+	const total = 2*tasksFlushInterval + 50
+	for i := 0; i < total; i++ {
+		task := &models.Task{
+			ID: uuid.New(), BoardID: boardID, Title: "task", Status: models.TaskStatusToDo,
+			CreatedAt: now, UpdatedAt: now,
+		}
+		if err := h.TaskRepo.Create(context.Background(), task); err != nil {
+			t.Fatalf("create task %d: %v", i, err)
+		}
+	}
+
+	body := list().Body.Bytes()
+	if !json.Valid(body) {
+		t.Fatalf("response is not valid JSON: %.200s", body)
+	}
+	var listed []struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(body, &listed); err != nil {
+		t.Fatalf("decode list: %v", err)
+	}
+	if len(listed) != total {
+		t.Fatalf("want %d tasks, got %d", total, len(listed))
+	}
+}
+
+// a status change by a board editor is recorded with the editor as changed_by
+func TestUpdateTask_StatusHistoryRecordsActingUser(t *testing.T) {
+	h, mux, dbx, secret := setupHTTP(t)
+	defer dbx.Close()
+	api := testAPI{t, mux, secret}
+
+	owner := uuid.New()
+	editor := uuid.New()
+	boardID := api.createBoard(owner.String(), "Shared")
+	taskID := api.createTask(owner.String(), boardID, "task")
+	if err := h.BoardRepo.AddMember(context.Background(), &models.BoardMember{
+		BoardID: uuid.MustParse(boardID), UserID: editor, Role: models.BoardRoleEditor, CreatedAt: time.Now().UTC(),
+	}); err != nil {
+		t.Fatalf("add editor: %v", err)
+	}
+
+	// the editor changes the status, so the history names them and not the board's owner
+	if rec := api.send(editor.String(), http.MethodPatch, "/tasks/"+taskID, `{"status":"done"}`); rec.Code != http.StatusOK {
+		t.Fatalf("editor update status: want 200, got %d body=%s", rec.Code, rec.Body.String())
+	}
+
+	history, err := h.TaskRepo.ListStatusHistory(context.Background(), taskID)
+	if err != nil {
+		t.Fatalf("list history: %v", err)
+	}
+	if len(history) != 1 {
+		t.Fatalf("want 1 history entry, got %d", len(history))
+	}
+	if history[0].ChangedBy != editor {
+		t.Fatalf("changed_by = %s, want acting user %s (owner is %s)", history[0].ChangedBy, editor, owner)
+	}
+	if history[0].FromStatus != models.TaskStatusToDo || history[0].ToStatus != models.TaskStatusDone {
+		t.Fatalf("unexpected transition %s -> %s", history[0].FromStatus, history[0].ToStatus)
+	}
+
+	// a title-only update doesn't add history
+	if rec := api.send(owner.String(), http.MethodPatch, "/tasks/"+taskID, `{"title":"renamed"}`); rec.Code != http.StatusOK {
+		t.Fatalf("update title: want 200, got %d", rec.Code)
+	}
+	if history, _ := h.TaskRepo.ListStatusHistory(context.Background(), taskID); len(history) != 1 {
+		t.Fatalf("want 1 history entry after title update, got %d", len(history))
+	}
+}
+
+// a status update is rejected, and nothing recorded, unless the context has a valid user to record
+func TestUpdateTask_StatusChangeWithoutActingUser(t *testing.T) {
+	h, mux, dbx, secret := setupHTTP(t)
+	defer dbx.Close()
+	api := testAPI{t, mux, secret}
+
+	owner := uuid.New().String()
+	boardID := api.createBoard(owner, "A")
+	taskID := api.createTask(owner, boardID, "task")
+
+	// a member row whose user_id can't be recorded as changed_by
+	const badUserID = "not-a-uuid"
+	if _, err := dbx.Exec(`INSERT INTO board_members (board_id, user_id, role, created_at) VALUES ($1, $2, $3, $4)`,
+		boardID, badUserID, models.BoardRoleEditor, time.Now().UTC()); err != nil {
+		t.Fatalf("add member: %v", err)
+	}
+
+	patchStatus := func(ctx context.Context) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPatch, "/tasks/"+taskID, strings.NewReader(`{"status":"done"}`))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		h.updateTaskByID(rec, req.WithContext(ctx), uuid.MustParse(taskID))
+		return rec
+	}
+
+	if rec := patchStatus(context.Background()); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("no user_id: want 401, got %d body=%s", rec.Code, rec.Body.String())
+	}
+	rec := patchStatus(context.WithValue(context.Background(), "user_id", badUserID))
+	if rec.Code != http.StatusInternalServerError || !strings.Contains(rec.Body.String(), "Cannot record status change") {
+		t.Fatalf("invalid user_id: want 500, got %d body=%s", rec.Code, rec.Body.String())
+	}
+
+	task, err := h.TaskRepo.GetByID(context.Background(), taskID)
+	if err != nil {
+		t.Fatalf("get task: %v", err)
+	}
+	if task.Status != models.TaskStatusToDo {
+		t.Fatalf("status changed to %q without a recorded change", task.Status)
+	}
+	if history, _ := h.TaskRepo.ListStatusHistory(context.Background(), taskID); len(history) != 0 {
+		t.Fatalf("want no history entries, got %d", len(history))
+	}
+}
+
+// a due date with a non-UTC offset is stored and returned as the same instant in UTC
+func TestTask_DueDateNormalizedToUTC(t *testing.T) {
+	h, mux, dbx, secret := setupHTTP(t)
+	defer dbx.Close()
+	api := testAPI{t, mux, secret}
+
+	user := uuid.New().String()
+	boardID := api.createBoard(user, "A")
+
+	const wantDue = "2024-05-31T15:00:00Z"
+	decodeDue := func(body []byte) string {
+		var resp []struct {
+			DueDate json.RawMessage
+		}
+		if err := json.Unmarshal(body, &resp); err != nil || len(resp) != 1 {
+			t.Fatalf("decode task: %v body=%s", err, body)
+		}
+		return strings.Trim(string(resp[0].DueDate), `"`)
+	}
+
+	rec := api.send(user, http.MethodPost, "/tasks",
+		`{"board_id":"`+boardID+`","title":"due","due_date":"2024-06-01T00:00:00+09:00"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("create task status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	if got := decodeDue(rec.Body.Bytes()); got != wantDue {
+		t.Fatalf("created due_date = %s, want %s", got, wantDue)
+	}
+	taskID := strings.TrimPrefix(rec.Header().Get("Location"), "/tasks/")
+
+	stored, err := h.TaskRepo.GetByID(context.Background(), taskID)
+	if err != nil {
+		t.Fatalf("get task: %v", err)
+	}
+	want := time.Date(2024, 5, 31, 15, 0, 0, 0, time.UTC)
+	if stored.DueDate == nil || !stored.DueDate.Equal(want) || stored.DueDate.Location() != time.UTC {
+		t.Fatalf("stored due date = %v, want %v", stored.DueDate, want)
+	}
+
+	recGet := api.send(user, http.MethodGet, "/tasks/"+taskID, "")
+	if recGet.Code != http.StatusOK {
+		t.Fatalf("get task status=%d", recGet.Code)
+	}
+	if got := decodeDue(recGet.Body.Bytes()); got != wantDue {
+		t.Fatalf("fetched due_date = %s, want %s", got, wantDue)
+	}
+
+	// update with a negative offset, then clear
+	patch := func(body string) *httptest.ResponseRecorder {
+		return api.send(user, http.MethodPatch, "/tasks/"+taskID, body)
+	}
+	recPatch := patch(`{"due_date":"2024-06-01T20:30:00-05:00"}`)
+	if recPatch.Code != http.StatusOK {
+		t.Fatalf("update due_date status=%d body=%s", recPatch.Code, recPatch.Body.String())
+	}
+	if got := decodeDue(recPatch.Body.Bytes()); got != "2024-06-02T01:30:00Z" {
+		t.Fatalf("updated due_date = %s", got)
+	}
+	if rec := patch(`{"due_date":"tomorrow"}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("invalid due_date: want 400, got %d", rec.Code)
+	}
+	recClear := patch(`{"due_date":""}`)
+	if recClear.Code != http.StatusOK {
+		t.Fatalf("clear due_date status=%d", recClear.Code)
+	}
+	if got := decodeDue(recClear.Body.Bytes()); got != "null" {
+		t.Fatalf("cleared due_date = %s, want null", got)
+	}
+}
+
+// deleted tasks are hidden; only admins see them with include_deleted=true
+func TestListTasks_IncludeDeleted(t *testing.T) {
+	h, mux, dbx, secret := setupHTTP(t)
+	defer dbx.Close()
+	api := testAPI{t, mux, secret}
+
+	owner := uuid.New().String()
+	admin := uuid.New().String()
+	h.AdminUserIDs = []string{admin}
+
+	boardID := api.createBoard(owner, "A")
+	taskIDs := []string{api.createTask(owner, boardID, "kept"), api.createTask(owner, boardID, "deleted")}
+	if rec := api.send(owner, http.MethodDelete, "/tasks/"+taskIDs[1], ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete task status=%d", rec.Code)
+	}
+
+	list := func(userID, query string) (int, []models.Task) {
+		rec := api.send(userID, http.MethodGet, "/tasks?board_id="+boardID+query, "")
+		var tasks []models.Task
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &tasks); err != nil {
+				t.Fatalf("decode list: %v", err)
+			}
+		}
+		return rec.Code, tasks
+	}
+
+	// the owner's include_deleted is ignored
+	code, tasks := list(owner, "&include_deleted=true")
+	if code != http.StatusOK || len(tasks) != 1 || tasks[0].ID.String() != taskIDs[0] {
+		t.Fatalf("owner: want only the kept task, got %d %+v", code, tasks)
+	}
+
+	// a stranger is still forbidden
+	if code, _ := list(uuid.New().String(), "&include_deleted=true"); code != http.StatusForbidden {
+		t.Fatalf("stranger: want 403, got %d", code)
+	}
+
+	if code, tasks := list(admin, ""); code != http.StatusOK || len(tasks) != 1 {
+		t.Fatalf("admin without include_deleted: want 1 task, got %d %+v", code, tasks)
+	}
+	code, tasks = list(admin, "&include_deleted=true")
+	if code != http.StatusOK || len(tasks) != 2 {
+		t.Fatalf("admin with include_deleted: want 2 tasks, got %d %+v", code, tasks)
+	}
+	for _, task := range tasks {
+		if (task.ID.String() == taskIDs[1]) != (task.DeletedAt != nil) {
+			t.Fatalf("deleted_at set on the wrong task: %+v", task)
+		}
+	}
+}
+
+// board_ids is bounded and every id must be a uuid
+func TestListTasks_BoardIDsBatch(t *testing.T) {
+	h, mux, dbx, secret := setupHTTP(t)
+	defer dbx.Close()
+	h.MaxBatchIDs = 3
+	api := testAPI{t, mux, secret}
+
+	user := uuid.New().String()
+	var boardIDs []string
+	for _, title := range []string{"A", "B"} {
+		boardID := api.createBoard(user, title)
+		api.createTask(user, boardID, "task "+title)
+		boardIDs = append(boardIDs, boardID)
+	}
+	list := func(boardIDs string) *httptest.ResponseRecorder {
+		return api.send(user, http.MethodGet, "/tasks?board_ids="+boardIDs, "")
+	}
+
+	rec := list(strings.Join(boardIDs, ","))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("batch list status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	var tasks []models.Task
+	if err := json.Unmarshal(rec.Body.Bytes(), &tasks); err != nil {
+		t.Fatalf("decode list: %v", err)
+	}
+	if len(tasks) != 2 {
+		t.Fatalf("want tasks of both boards, got %+v", tasks)
+	}
+
+	oversized := strings.Join([]string{
+		boardIDs[0], boardIDs[1], uuid.NewString(), uuid.NewString(),
+	}, ",")
+	if rec := list(oversized); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "too many ids") {
+		t.Fatalf("oversized batch: want 400, got %d body=%s", rec.Code, rec.Body.String())
+	}
+
+	if rec := list(boardIDs[0] + ",not-a-uuid"); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "invalid id") {
+		t.Fatalf("malformed id: want 400, got %d body=%s", rec.Code, rec.Body.String())
+	}
+
+	// a board the user can't read fails the whole batch
+	if rec := list(boardIDs[0] + "," + uuid.NewString()); rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown board: want 404, got %d", rec.Code)
+	}
+	otherBoardID := api.createBoard(uuid.New().String(), "other")
+	if rec := list(boardIDs[0] + "," + otherBoardID); rec.Code != http.StatusForbidden {
+		t.Fatalf("another user's board: want 403, got %d", rec.Code)
+	}
+}
+
+// task_ids returns the requested tasks if all of them are on the user's boards
+func TestListTasks_TaskIDsBatch(t *testing.T) {
+	_, mux, dbx, secret := setupHTTP(t)
+	defer dbx.Close()
+	api := testAPI{t, mux, secret}
+
+	user := uuid.New().String()
+	var taskIDs []string
+	for _, title := range []string{"A", "B"} {
+		taskIDs = append(taskIDs, api.createTask(user, api.createBoard(user, title), "task "+title))
+	}
+	list := func(taskIDs string) *httptest.ResponseRecorder {
+		return api.send(user, http.MethodGet, "/tasks?task_ids="+taskIDs, "")
+	}
+
+	rec := list(strings.Join(taskIDs, ","))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("batch get status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	var tasks []models.Task
+	if err := json.Unmarshal(rec.Body.Bytes(), &tasks); err != nil {
+		t.Fatalf("decode list: %v", err)
+	}
+	if len(tasks) != 2 {
+		t.Fatalf("want both tasks, got %+v", tasks)
+	}
+
+	if rec := list(taskIDs[0] + "," + uuid.NewString()); rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown task: want 404, got %d", rec.Code)
+	}
+
+	other := uuid.New().String()
+	otherTaskID := api.createTask(other, api.createBoard(other, "other"), "other")
+	if rec := list(taskIDs[0] + "," + otherTaskID); rec.Code != http.StatusForbidden {
+		t.Fatalf("another user's task: want 403, got %d", rec.Code)
+	}
+}
+
+// checks that board and task bodies with a second JSON object are rejected
+func TestBoardsAndTasks_TrailingJSONRejected(t *testing.T) {
+	_, mux, dbx, secret := setupHTTP(t)
+	defer dbx.Close()
+	api := testAPI{t, mux, secret}
+
+	user := uuid.New().String()
+	boardID := api.createBoard(user, "x")
+	taskID := api.createTask(user, boardID, "t")
+
+	cases := []struct{ method, path, body string }{
+		{http.MethodPost, "/boards", `{"title":"x"}{"title":"y"}`},
+		{http.MethodPut, "/boards/" + boardID, `{"title":"x"}{"title":"y"}`},
+		{http.MethodPost, "/tasks", `{"board_id":"` + boardID + `","title":"t"}{"title":"u"}`},
+		{http.MethodPut, "/tasks/" + taskID, `{"title":"t"} {"title":"u"}`},
+	}
+	for _, c := range cases {
+		if rec := api.send(user, c.method, c.path, c.body); rec.Code != http.StatusBadRequest {
+			t.Fatalf("%s %s: want 400, got %d body=%s", c.method, c.path, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+// as before canonical statuses, an empty status on update means to_do
+func TestUpdateTask_EmptyStatusResetsToDo(t *testing.T) {
+	_, mux, dbx, secret := setupHTTP(t)
+	defer dbx.Close()
+	api := testAPI{t, mux, secret}
+
+	user := uuid.New().String()
+	boardID := api.createBoard(user, "A")
+	rec := api.send(user, http.MethodPost, "/tasks", `{"board_id":"`+boardID+`","title":"t","status":"done"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("create task status=%d body=%s", rec.Code, rec.Body.String())
+	}
+	taskPath := rec.Header().Get("Location")
+
+	rec = api.send(user, http.MethodPatch, taskPath, `{"status":""}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("empty status: want 200, got %d body=%s", rec.Code, rec.Body.String())
+	}
+	var updated []struct {
+		Status models.TaskStatus `json:"status"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &updated); err != nil || len(updated) != 1 {
+		t.Fatalf("decode: %v body=%s", err, rec.Body.String())
+	}
+	if updated[0].Status != models.TaskStatusToDo {
+		t.Fatalf("status = %q, want %q", updated[0].Status, models.TaskStatusToDo)
+	}
+
+	if rec := api.send(user, http.MethodPatch, taskPath, `{"status":"blocked"}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("unknown status: want 400, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/chepyr/go-task-tracker/shared"
+	"github.com/google/uuid"
+)
+
+// looks up users, which live in the auth service's database
+type UserDirectory interface {
+	UserExists(ctx context.Context, userID uuid.UUID) (bool, error)
+}
+
+// UserDirectory backed by the auth service's internal GET /users/{id}
+type AuthServiceUsers struct {
+	BaseURL        string
+	InternalAPIKey string
+	Client         *http.Client
+}
+
+func NewAuthServiceUsers(baseURL, internalAPIKey string) *AuthServiceUsers {
+	return &AuthServiceUsers{
+		BaseURL:        strings.TrimRight(baseURL, "/"),
+		InternalAPIKey: internalAPIKey,
+		Client:         &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (u *AuthServiceUsers) UserExists(ctx context.Context, userID uuid.UUID) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.BaseURL+"/users/"+userID.String(), nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set(shared.InternalAPIKeyHeader, u.InternalAPIKey)
+
+	resp, err := u.Client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("auth service returned status %d", resp.StatusCode)
+	}
+}
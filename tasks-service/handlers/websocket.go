@@ -0,0 +1,525 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chepyr/go-task-tracker/shared"
+	"github.com/chepyr/go-task-tracker/shared/models"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// default number of outgoing messages queued per connection
+	DefaultWSSendBufferSize = 64
+
+	// default number of inbound messages a connection may send per second
+	DefaultWSMessageRateLimit = 20
+
+	wsWriteWait = 10 * time.Second
+
+	// a connection that sends nothing, not even a pong, for this long is dropped
+	wsPongWait = 60 * time.Second
+	// how often the server pings, well within wsPongWait
+	wsPingPeriod = 30 * time.Second
+)
+
+var (
+	errInvalidBoardID      = errors.New("invalid board id")
+	errMessageRateExceeded = errors.New("message rate exceeded")
+)
+
+type WSHub struct {
+	connections map[uuid.UUID]map[*wsClient]bool
+	mutex       sync.Mutex
+	broadcast   chan wsMessage
+
+	// SendBufferSize bounds the per-connection send queue. A client that lets
+	// its queue fill up is disconnected instead of blocking the broadcaster.
+	SendBufferSize int
+
+	// MessageLimiter bounds inbound messages per connection, keyed by client id.
+	// A client exceeding it is disconnected. Nil disables the limit.
+	MessageLimiter *RateLimiter
+
+	// EnableCompression negotiates per-message deflate with clients that offer it.
+	// Clients that don't are served uncompressed.
+	EnableCompression bool
+
+	// CoalesceWindow delays task updates for this long and sends only the
+	// latest update per (board, task) seen in the window. Zero disables it.
+	CoalesceWindow time.Duration
+
+	// cleared when the broadcaster goroutine exits
+	broadcasterAlive atomic.Bool
+
+	// keepalive timing, shortened in tests
+	pongWait   time.Duration
+	pingPeriod time.Duration
+
+	// set by Close; BroadcastTaskUpdate checks it and enqueues under
+	// closeMutex, so nothing is queued after the broadcaster drained.
+	// Not mutex: fanOut takes it, so enqueueing on a full queue under it would deadlock.
+	closed     bool
+	closeMutex sync.RWMutex
+
+	flush     chan wsMessageKey
+	closing   chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type wsMessageKey struct {
+	boardID uuid.UUID
+	taskID  uuid.UUID
+}
+
+// WSHubStats is a point-in-time view of the hub for health checks
+type WSHubStats struct {
+	Boards           int  `json:"boards"`
+	Connections      int  `json:"connections"`
+	BroadcasterAlive bool `json:"broadcaster_alive"`
+}
+
+type wsMessage struct {
+	boardID uuid.UUID
+	// set for task updates, which may be coalesced
+	taskID uuid.UUID
+	data   []byte
+}
+
+// wsClient is a single WebSocket connection with its own send queue.
+// Only writePump writes data frames to conn.
+type wsClient struct {
+	id        string
+	conn      *websocket.Conn
+	send      chan []byte
+	closeOnce sync.Once
+	// closed when writePump returns
+	drained chan struct{}
+}
+
+func NewWSHub() *WSHub {
+	hub := &WSHub{
+		connections:    make(map[uuid.UUID]map[*wsClient]bool),
+		broadcast:      make(chan wsMessage, 256),
+		SendBufferSize: DefaultWSSendBufferSize,
+		pongWait:       wsPongWait,
+		pingPeriod:     wsPingPeriod,
+		flush:          make(chan wsMessageKey),
+		closing:        make(chan struct{}),
+		done:           make(chan struct{}),
+	}
+	hub.broadcasterAlive.Store(true)
+	go hub.run()
+	return hub
+}
+
+// BroadcastTaskUpdate sends a task update to all WebSocket connections for a given board.
+func (hub *WSHub) BroadcastTaskUpdate(boardID uuid.UUID, task *models.Task) {
+	message, err := json.Marshal(map[string]any{
+		"event":   "task_updated",
+		"task_id": task.ID,
+		"title":   task.Title,
+		"status":  task.Status,
+	})
+	if err != nil {
+		log.Printf("Failed to marshal task update: %v", err)
+		return
+	}
+	// a read lock, so concurrent updates don't wait on each other
+	hub.closeMutex.RLock()
+	defer hub.closeMutex.RUnlock()
+	if hub.closed {
+		log.Printf("WebSocket hub closed, dropping update of task %s", task.ID)
+		return
+	}
+	select {
+	case hub.broadcast <- wsMessage{boardID: boardID, taskID: task.ID, data: message}:
+	case <-hub.done:
+		log.Printf("WebSocket broadcaster stopped, dropping update of task %s", task.ID)
+	}
+}
+
+/*
+Close stops the broadcaster after sending everything it has queued,
+including coalesced updates that are still waiting for their window,
+then closes every connection once its send queue is written out.
+*/
+func (hub *WSHub) Close() {
+	hub.closeOnce.Do(func() {
+		// waits for updates being enqueued, they are drained below
+		hub.closeMutex.Lock()
+		hub.closed = true
+		hub.closeMutex.Unlock()
+		close(hub.closing)
+	})
+	<-hub.done
+
+	hub.mutex.Lock()
+	var clients []*wsClient
+	for boardID, conns := range hub.connections {
+		for client := range conns {
+			clients = append(clients, client)
+			hub.removeLocked(boardID, client)
+		}
+	}
+	hub.mutex.Unlock()
+
+	timer := time.NewTimer(wsWriteWait)
+	defer timer.Stop()
+	expired := false
+	for _, client := range clients {
+		if !expired {
+			select {
+			case <-client.drained:
+			case <-timer.C:
+				expired = true
+			}
+		}
+		client.closeWith(websocket.CloseGoingAway, "server shutting down")
+	}
+}
+
+// run is the broadcaster goroutine: it fans every message out to the
+// send queues of the board's connections without ever blocking on a client.
+func (hub *WSHub) run() {
+	defer close(hub.done)
+	defer hub.broadcasterAlive.Store(false)
+
+	pending := make(map[wsMessageKey]wsMessage)
+	for {
+		select {
+		case msg := <-hub.broadcast:
+			hub.coalesce(pending, msg)
+		case key := <-hub.flush:
+			if msg, ok := pending[key]; ok {
+				delete(pending, key)
+				hub.fanOut(msg)
+			}
+		case <-hub.closing:
+			// queued messages are newer than the pending ones they replace
+		drain:
+			for {
+				select {
+				case msg := <-hub.broadcast:
+					delete(pending, wsMessageKey{msg.boardID, msg.taskID})
+					hub.fanOut(msg)
+				default:
+					break drain
+				}
+			}
+			for _, msg := range pending {
+				hub.fanOut(msg)
+			}
+			return
+		}
+	}
+}
+
+// keep only the latest update per task until its window ends
+func (hub *WSHub) coalesce(pending map[wsMessageKey]wsMessage, msg wsMessage) {
+	if hub.CoalesceWindow <= 0 || msg.taskID == uuid.Nil {
+		hub.fanOut(msg)
+		return
+	}
+	key := wsMessageKey{msg.boardID, msg.taskID}
+	if _, ok := pending[key]; !ok {
+		time.AfterFunc(hub.CoalesceWindow, func() {
+			select {
+			case hub.flush <- key:
+			case <-hub.done:
+			}
+		})
+	}
+	pending[key] = msg
+}
+
+/*
+Snapshot the hub without waiting on a busy mutex for long:
+the lock is only tried for up to wait, ok is false if it stayed busy.
+*/
+func (hub *WSHub) Stats(wait time.Duration) (stats WSHubStats, ok bool) {
+	deadline := time.Now().Add(wait)
+	for !hub.mutex.TryLock() {
+		if time.Now().After(deadline) {
+			return WSHubStats{BroadcasterAlive: hub.broadcasterAlive.Load()}, false
+		}
+		time.Sleep(time.Millisecond)
+	}
+	defer hub.mutex.Unlock()
+
+	stats.Boards = len(hub.connections)
+	for _, conns := range hub.connections {
+		stats.Connections += len(conns)
+	}
+	stats.BroadcasterAlive = hub.broadcasterAlive.Load()
+	return stats, true
+}
+
+func (hub *WSHub) fanOut(msg wsMessage) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	for client := range hub.connections[msg.boardID] {
+		select {
+		case client.send <- msg.data:
+		default:
+			log.Printf("WebSocket send buffer full, dropping connection for board %s", msg.boardID)
+			hub.removeLocked(msg.boardID, client)
+			go client.closeWith(websocket.ClosePolicyViolation, "send buffer full")
+		}
+	}
+}
+
+func (hub *WSHub) newClient(conn *websocket.Conn) *wsClient {
+	size := hub.SendBufferSize
+	if size <= 0 {
+		size = DefaultWSSendBufferSize
+	}
+	return &wsClient{
+		id:      uuid.NewString(),
+		conn:    conn,
+		send:    make(chan []byte, size),
+		drained: make(chan struct{}),
+	}
+}
+
+// writePump drains the send queue until it is closed by the hub.
+func (c *wsClient) writePump() {
+	defer close(c.drained)
+	for message := range c.send {
+		c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+		if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+			log.Printf("Failed to send WebSocket message: %v", err)
+			c.close()
+			return
+		}
+	}
+}
+
+// closeWith sends a close frame with the given code and reason, then closes the connection.
+func (c *wsClient) closeWith(code int, reason string) {
+	c.closeOnce.Do(func() {
+		closeConnWith(c.conn, code, reason)
+	})
+}
+
+func closeConnWith(conn *websocket.Conn, code int, reason string) {
+	conn.WriteControl(
+		websocket.CloseMessage, websocket.FormatCloseMessage(code, reason),
+		time.Now().Add(time.Second),
+	)
+	conn.Close()
+}
+
+func (c *wsClient) close() {
+	c.closeOnce.Do(func() {
+		c.conn.Close()
+	})
+}
+
+func (h *Handler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
+	if !h.allowRequest(r) {
+		shared.SendError(w, "Too many WebSocket connection attempts", http.StatusTooManyRequests)
+		return
+	}
+
+	conn, boardID, _, err := h.upgradeAndAuthorize(w, r)
+	if errors.Is(err, errInvalidBoardID) {
+		// a client error, the client is told the reason in the close frame
+		debugf("WebSocket rejected: %v (board_id=%q)", err, r.URL.Query().Get("board_id"))
+		return
+	}
+	if err != nil {
+		log.Printf("WebSocket auth/upgrade failed: %v", err)
+		return
+	}
+
+	client := h.WSHub.newClient(conn)
+	h.WSHub.register(boardID, client)
+	go client.writePump()
+	h.setupKeepAlive(boardID, client)
+
+	h.readLoop(boardID, client)
+}
+
+/*
+Upgrade the HTTP connection to a WebSocket and authorize the user for the specified board.
+*/
+func (h *Handler) upgradeAndAuthorize(w http.ResponseWriter, r *http.Request) (*websocket.Conn, uuid.UUID, string, error) {
+	upgrader := websocket.Upgrader{
+		CheckOrigin:       checkOrigin,
+		EnableCompression: h.WSHub.EnableCompression,
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return nil, uuid.Nil, "", err
+	}
+
+	boardIDStr := r.URL.Query().Get("board_id")
+	boardID, err := uuid.Parse(boardIDStr)
+	if err != nil {
+		// the connection is already upgraded, so the reason goes in the close frame
+		closeConnWith(conn, websocket.ClosePolicyViolation, errInvalidBoardID.Error())
+		return nil, uuid.Nil, "", errInvalidBoardID
+	}
+
+	uid, _ := r.Context().Value("user_id").(string)
+	board, err := h.BoardRepo.GetByID(r.Context(), boardIDStr)
+	if err != nil || board.OwnerID.String() != uid {
+		conn.Close()
+		return nil, uuid.Nil, "", fmt.Errorf("forbidden")
+	}
+
+	return conn, boardID, uid, nil
+}
+
+/*
+Check the Origin header against the allowed origins.
+An empty ALLOWED_ORIGINS allows all origins in development (for convenience),
+but denies all with ENV=production, where allowing all needs an explicit "*".
+*/
+func checkOrigin(r *http.Request) bool {
+	var allowed []string
+	for _, a := range strings.Split(os.Getenv("ALLOWED_ORIGINS"), ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			allowed = append(allowed, a)
+		}
+	}
+
+	if len(allowed) == 0 {
+		if os.Getenv("ENV") == "production" {
+			return false
+		}
+		warnAllowAllOrigins()
+		return true
+	}
+
+	origin := r.Header.Get("Origin")
+	for _, a := range allowed {
+		if a == "*" {
+			warnAllowAllOrigins()
+			return true
+		}
+		if a == origin {
+			return true
+		}
+	}
+	return false
+}
+
+var allowAllOriginsWarning sync.Once
+
+func warnAllowAllOrigins() {
+	allowAllOriginsWarning.Do(func() {
+		log.Printf("WARNING: WebSocket connections are accepted from any origin, set ALLOWED_ORIGINS")
+	})
+}
+
+func (hub *WSHub) register(boardID uuid.UUID, client *wsClient) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	if hub.connections[boardID] == nil {
+		hub.connections[boardID] = make(map[*wsClient]bool)
+	}
+	hub.connections[boardID][client] = true
+}
+
+func (hub *WSHub) unregister(boardID uuid.UUID, client *wsClient) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	hub.removeLocked(boardID, client)
+}
+
+// removeLocked drops the client from the board and stops its writePump.
+// The caller must hold hub.mutex.
+func (hub *WSHub) removeLocked(boardID uuid.UUID, client *wsClient) {
+	conns := hub.connections[boardID]
+	if !conns[client] {
+		return
+	}
+	delete(conns, client)
+	if len(conns) == 0 {
+		delete(hub.connections, boardID)
+	}
+	close(client.send)
+}
+
+func (h *Handler) setupKeepAlive(boardID uuid.UUID, client *wsClient) {
+	conn := client.conn
+	conn.SetReadLimit(1 << 20)
+	// pongs extend the deadline in readLoop's pong handler
+	conn.SetReadDeadline(time.Now().Add(h.WSHub.pongWait))
+	go func() {
+		ticker := time.NewTicker(h.WSHub.pingPeriod)
+		defer ticker.Stop()
+		for {
+			<-ticker.C
+			if err := conn.WriteControl(
+				websocket.PingMessage, []byte{}, time.Now().Add(10*time.Second),
+			); err != nil {
+				h.WSHub.unregister(boardID, client)
+				client.close()
+				return
+			}
+		}
+	}()
+}
+
+/*
+readLoop counts every inbound frame against MessageLimiter, pings and
+pongs included, so a client can't flood control frames past the limit.
+Pings are still answered with a pong, like the default handler does,
+and pongs extend the read deadline set by setupKeepAlive.
+*/
+func (h *Handler) readLoop(boardID uuid.UUID, client *wsClient) {
+	conn := client.conn
+	conn.SetPingHandler(func(appData string) error {
+		if !h.allowMessage(client) {
+			return errMessageRateExceeded
+		}
+		err := conn.WriteControl(websocket.PongMessage, []byte(appData), time.Now().Add(wsWriteWait))
+		var netErr net.Error
+		if errors.Is(err, websocket.ErrCloseSent) || (errors.As(err, &netErr) && netErr.Timeout()) {
+			return nil
+		}
+		return err
+	})
+	conn.SetPongHandler(func(string) error {
+		if !h.allowMessage(client) {
+			return errMessageRateExceeded
+		}
+		return conn.SetReadDeadline(time.Now().Add(h.WSHub.pongWait))
+	})
+
+	for {
+		_, _, err := conn.ReadMessage()
+		if errors.Is(err, errMessageRateExceeded) || (err == nil && !h.allowMessage(client)) {
+			log.Printf("WebSocket message rate exceeded, dropping connection for board %s", boardID)
+			h.WSHub.unregister(boardID, client)
+			client.closeWith(websocket.ClosePolicyViolation, "message rate exceeded")
+			break
+		}
+		if err != nil {
+			log.Printf("WebSocket closed: %v", err)
+			h.WSHub.unregister(boardID, client)
+			client.close()
+			break
+		}
+	}
+}
+
+func (h *Handler) allowMessage(client *wsClient) bool {
+	return h.WSHub.MessageLimiter == nil || h.WSHub.MessageLimiter.Allow(client.id)
+}
@@ -0,0 +1,437 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chepyr/go-task-tracker/shared/models"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// wsPair starts a server that hands its side of every upgraded
+// connection to the test; dial returns the client side.
+type wsPair struct {
+	server *httptest.Server
+	conns  chan *websocket.Conn
+}
+
+func newWSPair(t *testing.T) *wsPair {
+	t.Helper()
+	p := &wsPair{conns: make(chan *websocket.Conn, 4)}
+	upgrader := websocket.Upgrader{}
+	p.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		p.conns <- conn
+	}))
+	return p
+}
+
+func (p *wsPair) dial(t *testing.T) (client, server *websocket.Conn) {
+	t.Helper()
+	url := "ws" + strings.TrimPrefix(p.server.URL, "http")
+	client, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	select {
+	case server = <-p.conns:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("server side of connection not received")
+	}
+	return client, server
+}
+
+// a client that never drains its queue is dropped with a policy close code
+// once the queue is full, while other clients on the board keep receiving
+func TestWSHub_DropsSlowConsumer(t *testing.T) {
+	p := newWSPair(t)
+	defer p.server.Close()
+
+	hub := NewWSHub()
+	hub.SendBufferSize = 2
+	boardID := uuid.New()
+
+	stalledConn, stalledServer := p.dial(t)
+	defer stalledConn.Close()
+	healthyConn, healthyServer := p.dial(t)
+	defer healthyConn.Close()
+
+	// stalled client: registered, but its writePump is never started
+	stalled := hub.newClient(stalledServer)
+	hub.register(boardID, stalled)
+
+	healthy := hub.newClient(healthyServer)
+	hub.register(boardID, healthy)
+	go healthy.writePump()
+
+	// the healthy client reads every update before the next one is sent,
+	// so only the stalled client's queue can fill up
+	healthyConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for i := 0; i < 5; i++ {
+		hub.BroadcastTaskUpdate(boardID, &models.Task{ID: uuid.New(), Title: "t"})
+		if _, _, err := healthyConn.ReadMessage(); err != nil {
+			t.Fatalf("healthy client read %d: %v", i+1, err)
+		}
+	}
+
+	stalledConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err := stalledConn.ReadMessage()
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.ClosePolicyViolation {
+		t.Fatalf("want close %d for stalled client, got %v", websocket.ClosePolicyViolation, err)
+	}
+
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	if hub.connections[boardID][stalled] {
+		t.Fatalf("stalled client should be removed from hub")
+	}
+	if !hub.connections[boardID][healthy] {
+		t.Fatalf("healthy client should stay registered")
+	}
+}
+
+// a client sending messages faster than the limit is closed with a policy code
+func TestReadLoop_ClosesOnMessageRateExceeded(t *testing.T) {
+	p := newWSPair(t)
+	defer p.server.Close()
+
+	hub := NewWSHub()
+	hub.MessageLimiter = NewRateLimiter(3, time.Minute)
+	h := &Handler{WSHub: hub}
+	boardID := uuid.New()
+
+	clientConn, serverConn := p.dial(t)
+	defer clientConn.Close()
+
+	client := hub.newClient(serverConn)
+	hub.register(boardID, client)
+	go client.writePump()
+	done := make(chan struct{})
+	go func() {
+		h.readLoop(boardID, client)
+		close(done)
+	}()
+
+	for i := 0; i < 10; i++ {
+		// writes may start failing once the server has closed the connection
+		if err := clientConn.WriteMessage(websocket.TextMessage, []byte(`{"type":"subscribe"}`)); err != nil {
+			break
+		}
+	}
+
+	clientConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err := clientConn.ReadMessage()
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.ClosePolicyViolation {
+		t.Fatalf("want close %d, got %v", websocket.ClosePolicyViolation, err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("readLoop did not return")
+	}
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	if hub.connections[boardID][client] {
+		t.Fatalf("client should be removed from hub")
+	}
+}
+
+// pings count against the message limit too, and are answered while under it
+func TestReadLoop_ClosesOnPingFlood(t *testing.T) {
+	p := newWSPair(t)
+	defer p.server.Close()
+
+	hub := NewWSHub()
+	hub.MessageLimiter = NewRateLimiter(3, time.Minute)
+	h := &Handler{WSHub: hub}
+	boardID := uuid.New()
+
+	clientConn, serverConn := p.dial(t)
+	defer clientConn.Close()
+
+	client := hub.newClient(serverConn)
+	hub.register(boardID, client)
+	go client.writePump()
+	done := make(chan struct{})
+	go func() {
+		h.readLoop(boardID, client)
+		close(done)
+	}()
+
+	pongs := make(chan struct{}, 10)
+	clientConn.SetPongHandler(func(string) error {
+		pongs <- struct{}{}
+		return nil
+	})
+	for i := 0; i < 10; i++ {
+		// writes may start failing once the server has closed the connection
+		if err := clientConn.WriteControl(websocket.PingMessage, []byte("ping"), time.Now().Add(time.Second)); err != nil {
+			break
+		}
+	}
+
+	clientConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err := clientConn.ReadMessage()
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.ClosePolicyViolation {
+		t.Fatalf("want close %d, got %v", websocket.ClosePolicyViolation, err)
+	}
+	if len(pongs) == 0 {
+		t.Fatalf("pings under the limit should be answered")
+	}
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("readLoop did not return")
+	}
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	if hub.connections[boardID][client] {
+		t.Fatalf("client should be removed from hub")
+	}
+}
+
+// an idle client that only answers the server's pings stays connected past the read deadline
+func TestKeepAlive_PongsExtendReadDeadline(t *testing.T) {
+	p := newWSPair(t)
+	defer p.server.Close()
+
+	hub := NewWSHub()
+	hub.pongWait = 300 * time.Millisecond
+	hub.pingPeriod = 100 * time.Millisecond
+	hub.MessageLimiter = NewRateLimiter(100, time.Minute)
+	h := &Handler{WSHub: hub}
+	boardID := uuid.New()
+
+	clientConn, serverConn := p.dial(t)
+	defer clientConn.Close()
+
+	client := hub.newClient(serverConn)
+	hub.register(boardID, client)
+	go client.writePump()
+	h.setupKeepAlive(boardID, client)
+	go h.readLoop(boardID, client)
+
+	// reading lets the client's default ping handler answer with pongs
+	readErr := make(chan error, 1)
+	go func() {
+		_, _, err := clientConn.ReadMessage()
+		readErr <- err
+	}()
+
+	select {
+	case err := <-readErr:
+		t.Fatalf("connection dropped while answering pings: %v", err)
+	case <-time.After(4 * hub.pongWait):
+	}
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	if !hub.connections[boardID][client] {
+		t.Fatalf("client answering pings should stay registered")
+	}
+}
+
+// with compression enabled, compressing and plain clients both receive updates
+func TestHandleWebSocket_Compression(t *testing.T) {
+	h, mux, dbx, secret := setupHTTP(t)
+	defer dbx.Close()
+	h.WSHub.EnableCompression = true
+	t.Setenv("ALLOWED_ORIGINS", "")
+
+	owner := uuid.New()
+	boardID := uuid.New()
+	now := time.Now().UTC()
+	if err := h.BoardRepo.Create(context.Background(), &models.Board{
+		ID: boardID, OwnerID: owner, Title: "ws", CreatedAt: now, UpdatedAt: now,
+	}); err != nil {
+		t.Fatalf("create board: %v", err)
+	}
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?board_id=" + boardID.String()
+	header := http.Header{"Authorization": {bearerForUser(t, secret, owner.String())}}
+
+	dial := func(compress bool) *websocket.Conn {
+		dialer := websocket.Dialer{EnableCompression: compress}
+		conn, resp, err := dialer.Dial(url, header)
+		if err != nil {
+			t.Fatalf("dial (compression=%v): %v", compress, err)
+		}
+		negotiated := strings.Contains(resp.Header.Get("Sec-WebSocket-Extensions"), "permessage-deflate")
+		if negotiated != compress {
+			t.Fatalf("compression=%v: negotiated=%v", compress, negotiated)
+		}
+		return conn
+	}
+	compressed := dial(true)
+	defer compressed.Close()
+	plain := dial(false)
+	defer plain.Close()
+
+	// wait until both connections are registered before broadcasting
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		h.WSHub.mutex.Lock()
+		n := len(h.WSHub.connections[boardID])
+		h.WSHub.mutex.Unlock()
+		if n == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("want 2 registered connections, got %d", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	task := &models.Task{ID: uuid.New(), Title: strings.Repeat("compressible ", 50)}
+	h.WSHub.BroadcastTaskUpdate(boardID, task)
+
+	for name, conn := range map[string]*websocket.Conn{"compressed": compressed, "plain": plain} {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		var msg struct {
+			TaskID uuid.UUID `json:"task_id"`
+			Title  string    `json:"title"`
+		}
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("%s client read: %v", name, err)
+		}
+		if msg.TaskID != task.ID || msg.Title != task.Title {
+			t.Fatalf("%s client got unexpected message %+v", name, msg)
+		}
+	}
+}
+
+// a malformed board_id gets a close frame with the reason instead of a bare disconnect
+func TestHandleWebSocket_InvalidBoardIDCloseReason(t *testing.T) {
+	_, mux, dbx, secret := setupHTTP(t)
+	defer dbx.Close()
+	t.Setenv("ALLOWED_ORIGINS", "")
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?board_id=not-a-uuid"
+	header := http.Header{"Authorization": {bearerForUser(t, secret, uuid.New().String())}}
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, header)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err = conn.ReadMessage()
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) {
+		t.Fatalf("want close frame, got %v", err)
+	}
+	if closeErr.Code != websocket.ClosePolicyViolation || closeErr.Text != "invalid board id" {
+		t.Fatalf("want close %d %q, got %d %q",
+			websocket.ClosePolicyViolation, "invalid board id", closeErr.Code, closeErr.Text)
+	}
+}
+
+// three rapid updates of one task within the window are sent once, with the latest state
+func TestWSHub_CoalescesRapidUpdates(t *testing.T) {
+	p := newWSPair(t)
+	defer p.server.Close()
+
+	hub := NewWSHub()
+	hub.CoalesceWindow = 100 * time.Millisecond
+	defer hub.Close()
+	boardID := uuid.New()
+
+	clientConn, serverConn := p.dial(t)
+	defer clientConn.Close()
+	client := hub.newClient(serverConn)
+	hub.register(boardID, client)
+	go client.writePump()
+
+	task := &models.Task{ID: uuid.New()}
+	for _, title := range []string{"a", "ab", "abc"} {
+		task.Title = title
+		hub.BroadcastTaskUpdate(boardID, task)
+	}
+
+	var msg struct {
+		Title string `json:"title"`
+	}
+	clientConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if err := clientConn.ReadJSON(&msg); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if msg.Title != "abc" {
+		t.Fatalf("want latest title %q, got %q", "abc", msg.Title)
+	}
+
+	clientConn.SetReadDeadline(time.Now().Add(3 * hub.CoalesceWindow))
+	if _, data, err := clientConn.ReadMessage(); err == nil {
+		t.Fatalf("want a single broadcast, got another: %s", data)
+	}
+}
+
+// an update still waiting for its window is sent on Close
+func TestWSHub_CloseFlushesPendingUpdates(t *testing.T) {
+	p := newWSPair(t)
+	defer p.server.Close()
+
+	hub := NewWSHub()
+	hub.CoalesceWindow = time.Hour
+	boardID := uuid.New()
+
+	clientConn, serverConn := p.dial(t)
+	defer clientConn.Close()
+	client := hub.newClient(serverConn)
+	hub.register(boardID, client)
+	go client.writePump()
+
+	hub.BroadcastTaskUpdate(boardID, &models.Task{ID: uuid.New(), Title: "final"})
+	hub.Close()
+
+	var msg struct {
+		Title string `json:"title"`
+	}
+	clientConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if err := clientConn.ReadJSON(&msg); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if msg.Title != "final" {
+		t.Fatalf("want the pending update, got %q", msg.Title)
+	}
+
+	_, _, err := clientConn.ReadMessage()
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseGoingAway {
+		t.Fatalf("want close %d after the flush, got %v", websocket.CloseGoingAway, err)
+	}
+	if stats, _ := hub.Stats(time.Second); stats.BroadcasterAlive || stats.Connections != 0 {
+		t.Fatalf("hub should be stopped and empty after Close: %+v", stats)
+	}
+}
+
+// updates after Close are dropped instead of being queued where nothing reads them
+func TestWSHub_BroadcastAfterCloseIsDropped(t *testing.T) {
+	hub := NewWSHub()
+	hub.Close()
+
+	for i := 0; i < 100; i++ {
+		hub.BroadcastTaskUpdate(uuid.New(), &models.Task{ID: uuid.New(), Title: "late"})
+	}
+	if n := len(hub.broadcast); n != 0 {
+		t.Fatalf("want no queued updates after Close, got %d", n)
+	}
+}
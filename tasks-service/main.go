@@ -8,35 +8,46 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/chepyr/go-task-tracker/shared"
 	"github.com/chepyr/go-task-tracker/tasks-service/db"
 	"github.com/chepyr/go-task-tracker/tasks-service/handlers"
 	_ "github.com/lib/pq"
 )
 
 func main() {
-	validateEnv()
+	jwtSecret := validateEnv()
 	dbConn := initDB()
 	defer dbConn.Close()
 
-	initHandlers(dbConn)
+	handler := initHandlers(dbConn, jwtSecret)
 	server := initServer()
-	startServer(server)
+	startServer(server, handler.WSHub)
 }
 
-func validateEnv() {
+// returns the JWT secret, loaded from JWT_SECRET or JWT_SECRET_FILE
+func validateEnv() string {
 	requiredEnvVars := []string{
 		"POSTGRES_USER", "POSTGRES_PASSWORD", "POSTGRES_DB",
 		"POSTGRES_HOST", "POSTGRES_PORT", "SERVER_PORT_TASKS",
-		"JWT_SECRET", "AUTH_SERVICE_URL",
+		"AUTH_SERVICE_URL",
 	}
 	for _, env := range requiredEnvVars {
 		if os.Getenv(env) == "" {
 			log.Fatalf("Environment variable %s must be set", env)
 		}
 	}
+
+	// only the auth service, which signs the tokens, enforces a minimum length
+	secret, err := shared.LoadJWTSecret(0)
+	if err != nil {
+		log.Fatalf("Invalid JWT secret: %v", err)
+	}
+	return secret
 }
 
 func initDB() *sql.DB {
@@ -57,23 +68,82 @@ func initDB() *sql.DB {
 	return dbConn
 }
 
-func initHandlers(dbConn *sql.DB) *handlers.Handler {
+func initHandlers(dbConn *sql.DB, jwtSecret string) *handlers.Handler {
+	wsHub := handlers.NewWSHub()
+	wsHub.SendBufferSize = envInt("WS_SEND_BUFFER_SIZE", handlers.DefaultWSSendBufferSize)
+	wsHub.MessageLimiter = handlers.NewRateLimiter(
+		envInt("WS_MESSAGE_RATE_LIMIT", handlers.DefaultWSMessageRateLimit), time.Second)
+	wsHub.EnableCompression = os.Getenv("WS_ENABLE_COMPRESSION") == "true"
+	wsHub.CoalesceWindow = envDuration("WS_COALESCE_WINDOW", 0)
+
+	taskRepo := db.NewTaskRepository(dbConn)
+	// fail reads of tasks with non-canonical statuses instead of coercing them
+	taskRepo.StrictStatuses = os.Getenv("STRICT_TASK_STATUSES") == "true"
+
 	handler := &handlers.Handler{
 		BoardRepo:   db.NewBoardRepository(dbConn),
-		TaskRepo:    db.NewTaskRepository(dbConn),
+		TaskRepo:    taskRepo,
 		RateLimiter: handlers.NewRateLimiter(5, time.Second),
-		WSHub:       handlers.NewWSHub(),
+		WSHub:       wsHub,
+		OwnerCache:  handlers.NewOwnershipCache(envDuration("OWNER_CACHE_TTL", handlers.DefaultOwnerCacheTTL)),
+		Users:       handlers.NewAuthServiceUsers(os.Getenv("AUTH_SERVICE_URL"), os.Getenv("INTERNAL_API_KEY")),
+		JWTSecret:   jwtSecret,
+
+		StrictBodies:      os.Getenv("STRICT_BODIES") == "true",
+		AllowTrailingJSON: os.Getenv("ALLOW_TRAILING_JSON") == "true",
+		InternalAPIKey:    os.Getenv("INTERNAL_API_KEY"),
+		AdminUserIDs:      envList("ADMIN_USER_IDS"),
+		MaxBatchIDs:       envInt("MAX_BATCH_IDS", handlers.DefaultMaxBatchIDs),
 	}
-	http.HandleFunc("/boards", handler.AuthMiddleware(handler.HandleBoards))
-	http.HandleFunc("/boards/", handler.AuthMiddleware(handler.HandleBoardByID))
+	http.HandleFunc("/boards", handler.NoBodyMiddleware(handler.AuthMiddleware(handler.HandleBoards)))
+	http.HandleFunc("/boards/", handler.NoBodyMiddleware(handler.AuthMiddleware(handler.HandleBoardByID)))
 
-	http.HandleFunc("/tasks", handler.AuthMiddleware(handler.HandleTasks))
-	http.HandleFunc("/tasks/", handler.AuthMiddleware(handler.HandleTaskByID))
+	http.HandleFunc("/tasks", handler.NoBodyMiddleware(handler.AuthMiddleware(handler.HandleTasks)))
+	http.HandleFunc("/tasks/", handler.NoBodyMiddleware(handler.AuthMiddleware(handler.HandleTaskByID)))
 
-	http.HandleFunc("/ws", handler.AuthMiddleware(handler.HandleWebSocket))
+	http.HandleFunc("/ws", handler.NoBodyMiddleware(handler.AuthMiddleware(handler.HandleWebSocket)))
+	http.HandleFunc("/ratelimit/", handler.NoBodyMiddleware(handler.AuthMiddleware(handler.HandleRateLimit)))
+	http.HandleFunc("/healthz/ws", handler.NoBodyMiddleware(handler.HandleWSHealth))
 	return handler
 }
 
+// read a positive integer from the environment, falling back to def
+func envInt(name string, def int) int {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return def
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil || value <= 0 {
+		log.Fatalf("Environment variable %s must be a positive integer", name)
+	}
+	return value
+}
+
+// read a non-negative duration like "200ms" from the environment, falling back to def
+func envDuration(name string, def time.Duration) time.Duration {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return def
+	}
+	value, err := time.ParseDuration(raw)
+	if err != nil || value < 0 {
+		log.Fatalf("Environment variable %s must be a duration like 200ms", name)
+	}
+	return value
+}
+
+// read a comma-separated list from the environment, skipping empty items
+func envList(name string) []string {
+	var items []string
+	for _, item := range strings.Split(os.Getenv(name), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func initServer() *http.Server {
 	return &http.Server{
 		Addr:              ":" + os.Getenv("SERVER_PORT_TASKS"),
@@ -81,14 +151,17 @@ func initServer() *http.Server {
 		ReadTimeout:       10 * time.Second,
 		WriteTimeout:      15 * time.Second,
 		IdleTimeout:       60 * time.Second,
+		Handler:           shared.Recover(http.DefaultServeMux),
 	}
 }
 
-func startServer(server *http.Server) {
+// the hub is closed on every exit path, so pending WebSocket updates are sent
+func startServer(server *http.Server, hub *handlers.WSHub) {
 	log.Printf("Starting tasks server on :%s", os.Getenv("SERVER_PORT_TASKS"))
 
 	go func() {
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			hub.Close()
 			log.Fatalf("Server failed: %v", err)
 		}
 	}()
@@ -100,7 +173,10 @@ func startServer(server *http.Server) {
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	if err := server.Shutdown(ctx); err != nil {
+	err := server.Shutdown(ctx)
+	// send coalesced WebSocket updates that are still pending
+	hub.Close()
+	if err != nil {
 		log.Fatalf("Server shutdown failed: %v", err)
 	}
 	log.Println("Server stopped")